@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTrackerTiers(t *testing.T) {
+	var tiers trackerTiers
+	for _, s := range []string{"http://a/announce", "udp://b:80, udp://c:80"} {
+		if err := tiers.Set(s); err != nil {
+			t.Fatalf("Set(%q): %v", s, err)
+		}
+	}
+	want := trackerTiers{{"http://a/announce"}, {"udp://b:80", "udp://c:80"}}
+	if !reflect.DeepEqual(tiers, want) {
+		t.Errorf("tiers = %v, want %v", tiers, want)
+	}
+	if err := tiers.Set(" , "); err == nil {
+		t.Error("Set accepted an empty tier")
+	}
+}
+
+func TestRunCreate_CurrentDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "album")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := runCreate([]string{"-no-date", "."}, io.Discard); err != nil {
+		t.Fatalf("create .: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "album.torrent")); err != nil {
+		t.Errorf("default output: %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/harioms1522/BitSwift/internal/bencode"
+)
+
+// hexKey marks a binary string in JSON output: {"$hex": "0a1b..."}. Reverse mode turns
+// such objects back into byte strings.
+const hexKey = "$hex"
+
+// lenKey replaces a binary string in JSON output with its length when -bin len is used.
+const lenKey = "$len"
+
+// dumpOptions controls how dump renders a decoded value.
+type dumpOptions struct {
+	Tree bool // annotated tree instead of JSON
+	Hex  bool // binary strings as hex rather than a length summary
+}
+
+// runDump implements "bitswift dump": it prints any bencoded file as JSON or a tree, or
+// with -reverse converts JSON back to bencode.
+func runDump(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	format := fs.String("format", "json", "output format: json or tree")
+	bin := fs.String("bin", "", "binary strings: hex or len (default hex for json, len for tree)")
+	reverse := fs.Bool("reverse", false, "convert JSON (as printed by dump) back to bencode")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: bitswift dump [-format json|tree] [-bin hex|len] [-reverse] <file|->\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("dump: expected one file")
+	}
+	data, err := readInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *reverse {
+		out, err := jsonToBencode(data)
+		if err != nil {
+			return err
+		}
+		_, err = stdout.Write(out)
+		return err
+	}
+
+	var opts dumpOptions
+	switch *format {
+	case "json":
+	case "tree":
+		opts.Tree = true
+	default:
+		return fmt.Errorf("dump: unknown format %q", *format)
+	}
+	switch *bin {
+	case "":
+		opts.Hex = !opts.Tree
+	case "hex":
+		opts.Hex = true
+	case "len":
+	default:
+		return fmt.Errorf("dump: unknown -bin value %q", *bin)
+	}
+	return dump(stdout, data, opts)
+}
+
+// readInput reads the named file, or standard input for "-".
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("file not found: %s", path)
+	}
+	return data, err
+}
+
+// dump decodes bencoded data and writes it to w.
+func dump(w io.Writer, data []byte, opts dumpOptions) error {
+	v, err := bencode.DecodeWithOptions(data, bencode.DecoderOptions{ZeroCopy: true})
+	if err != nil {
+		return err
+	}
+	if opts.Tree {
+		var b strings.Builder
+		writeTree(&b, v, "", opts)
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	j, err := toJSON(v, opts)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(j)
+}
+
+// isText reports whether a byte string is printable UTF-8 and can be shown as text.
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// toJSON converts a decoded bencode value into a value encoding/json can marshal.
+func toJSON(v bencode.Value, opts dumpOptions) (any, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case []byte:
+		if isText(v) {
+			return string(v), nil
+		}
+		if opts.Hex {
+			return map[string]string{hexKey: hex.EncodeToString(v)}, nil
+		}
+		return map[string]int{lenKey: len(v)}, nil
+	case []bencode.Value:
+		list := make([]any, len(v))
+		for i, e := range v {
+			j, err := toJSON(e, opts)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = j
+		}
+		return list, nil
+	case map[string]bencode.Value:
+		dict := make(map[string]any, len(v))
+		for k, e := range v {
+			if !utf8.ValidString(k) {
+				return nil, fmt.Errorf("dump: dictionary key %x is not valid UTF-8; use -format tree", k)
+			}
+			j, err := toJSON(e, opts)
+			if err != nil {
+				return nil, err
+			}
+			dict[k] = j
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("dump: unexpected value %T", v)
+}
+
+// writeTree writes v as an indented tree, one value per line, annotated with sizes.
+// indent is the prefix for the lines of v's children.
+func writeTree(b *strings.Builder, v bencode.Value, indent string, opts dumpOptions) {
+	switch v := v.(type) {
+	case int64:
+		fmt.Fprintf(b, "%d\n", v)
+	case []byte:
+		switch {
+		case isText(v):
+			fmt.Fprintf(b, "%s\n", strconv.Quote(string(v)))
+		case opts.Hex:
+			fmt.Fprintf(b, "<%d bytes> %x\n", len(v), v)
+		default:
+			fmt.Fprintf(b, "<binary, %d bytes>\n", len(v))
+		}
+	case []bencode.Value:
+		fmt.Fprintf(b, "list (%s)\n", plural(len(v), "item"))
+		for i, e := range v {
+			writeChild(b, fmt.Sprintf("[%d]", i), e, indent, i == len(v)-1, opts)
+		}
+	case map[string]bencode.Value:
+		fmt.Fprintf(b, "dict (%s)\n", plural(len(v), "key"))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			label := k
+			if k == "" {
+				label = `""`
+			} else if !isText([]byte(k)) {
+				label = "<" + hex.EncodeToString([]byte(k)) + ">"
+			}
+			writeChild(b, label, v[k], indent, i == len(keys)-1, opts)
+		}
+	}
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return strconv.Itoa(n) + " " + noun + "s"
+}
+
+func writeChild(b *strings.Builder, label string, v bencode.Value, indent string, last bool, opts dumpOptions) {
+	branch, next := "├── ", "│   "
+	if last {
+		branch, next = "└── ", "    "
+	}
+	b.WriteString(indent + branch + label + ": ")
+	writeTree(b, v, indent+next, opts)
+}
+
+// jsonToBencode converts JSON as printed by dump back to bencode. Integers become bencode
+// integers, strings and {"$hex": ...} objects become byte strings, and arrays and objects
+// become lists and dictionaries.
+func jsonToBencode(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var j any
+	if err := dec.Decode(&j); err != nil {
+		return nil, fmt.Errorf("dump: invalid JSON: %w", err)
+	}
+	v, err := fromJSON(j)
+	if err != nil {
+		return nil, err
+	}
+	return bencode.Encode(v)
+}
+
+func fromJSON(j any) (bencode.Value, error) {
+	switch j := j.(type) {
+	case json.Number:
+		n, err := strconv.ParseInt(j.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("dump: %s is not a 64-bit integer", j)
+		}
+		return n, nil
+	case string:
+		return []byte(j), nil
+	case []any:
+		list := make([]bencode.Value, len(j))
+		for i, e := range j {
+			v, err := fromJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v
+		}
+		return list, nil
+	case map[string]any:
+		if len(j) == 1 {
+			if h, ok := j[hexKey].(string); ok {
+				b, err := hex.DecodeString(h)
+				if err != nil {
+					return nil, fmt.Errorf("dump: invalid %s string: %w", hexKey, err)
+				}
+				return b, nil
+			}
+			if _, ok := j[lenKey]; ok {
+				return nil, fmt.Errorf("dump: binary string was summarized by -bin len; dump with -bin hex to convert back")
+			}
+		}
+		dict := make(map[string]bencode.Value, len(j))
+		for k, e := range j {
+			v, err := fromJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			dict[k] = v
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("dump: bencode has no equivalent of JSON %v", j)
+}
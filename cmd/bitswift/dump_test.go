@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDumpRoundTrip(t *testing.T) {
+	for _, name := range []string{"valid.torrent", "game.torrent", "ubuntu-24.04.3-desktop-amd64.iso.torrent"} {
+		data, err := os.ReadFile(filepath.Join("..", "..", "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := dump(&out, data, dumpOptions{Hex: true}); err != nil {
+			t.Fatalf("%s: dump: %v", name, err)
+		}
+		back, err := jsonToBencode(out.Bytes())
+		if err != nil {
+			t.Fatalf("%s: reverse: %v", name, err)
+		}
+		if !bytes.Equal(back, data) {
+			t.Errorf("%s: JSON round trip changed the file", name)
+		}
+	}
+}
+
+func TestDumpFormats(t *testing.T) {
+	input := []byte("d4:name4:test5:peers6:\x7f\x00\x00\x01\x1a\xe1e")
+	tests := []struct {
+		opts dumpOptions
+		want string
+	}{
+		{dumpOptions{Hex: true}, "{\n  \"name\": \"test\",\n  \"peers\": {\n    \"$hex\": \"7f0000011ae1\"\n  }\n}\n"},
+		{dumpOptions{}, "{\n  \"name\": \"test\",\n  \"peers\": {\n    \"$len\": 6\n  }\n}\n"},
+		{dumpOptions{Tree: true}, "dict (2 keys)\n├── name: \"test\"\n└── peers: <binary, 6 bytes>\n"},
+		{dumpOptions{Tree: true, Hex: true}, "dict (2 keys)\n├── name: \"test\"\n└── peers: <6 bytes> 7f0000011ae1\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := dump(&out, input, tt.opts); err != nil {
+			t.Fatalf("dump(%+v): %v", tt.opts, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("dump(%+v) =\n%s\nwant\n%s", tt.opts, out.String(), tt.want)
+		}
+	}
+}
+
+func TestJSONToBencodeErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`1.5`, "not a 64-bit integer"},
+		{`true`, "no equivalent"},
+		{`{"$hex": "zz"}`, "invalid $hex"},
+		{`{"$len": 6}`, "summarized"},
+		{`{`, "invalid JSON"},
+	}
+	for _, tt := range tests {
+		_, err := jsonToBencode([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("jsonToBencode(%s) = %v, want error containing %q", tt.input, err, tt.want)
+		}
+	}
+}
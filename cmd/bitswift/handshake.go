@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/harioms1522/BitSwift/internal/peer"
+)
+
+// outcome classifies the result of a handshake with one peer.
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeRefused
+	outcomeTimeout
+	outcomeInfoHashMismatch
+	outcomeProtocolMismatch
+	outcomeOther
+	numOutcomes
+)
+
+var outcomeNames = [numOutcomes]string{
+	outcomeSuccess:          "success",
+	outcomeRefused:          "refused",
+	outcomeTimeout:          "timeout",
+	outcomeInfoHashMismatch: "info-hash mismatch",
+	outcomeProtocolMismatch: "protocol mismatch",
+	outcomeOther:            "other error",
+}
+
+func (o outcome) String() string {
+	return outcomeNames[o]
+}
+
+// classify maps a handshake error to its outcome.
+func classify(err error) outcome {
+	var ne net.Error
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case errors.Is(err, peer.ErrInfoHashMismatch):
+		return outcomeInfoHashMismatch
+	case errors.Is(err, peer.ErrProtocolMismatch), errors.Is(err, peer.ErrHandshakeLength):
+		return outcomeProtocolMismatch
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return outcomeRefused
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return outcomeTimeout
+	}
+	return outcomeOther
+}
+
+type handshakeResult struct {
+	addr    string
+	outcome outcome
+	err     error
+}
+
+// handshakeAll handshakes with every peer in addrs, at most concurrency at a time, each
+// within timeout. The results are in the order of addrs. Peers not yet tried when ctx
+// ends fail with the context's error.
+func handshakeAll(ctx context.Context, d peer.Dialer, addrs []string, our *peer.Handshake, concurrency int, timeout time.Duration) []handshakeResult {
+	results := make([]handshakeResult, len(addrs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(max(concurrency, 1), len(addrs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				hctx, cancel := context.WithTimeout(ctx, timeout)
+				_, err := peer.DoHandshakeContext(hctx, d, addrs[i], our, our.InfoHash)
+				cancel()
+				results[i] = handshakeResult{addr: addrs[i], outcome: classify(err), err: err}
+			}
+		}()
+	}
+	for i := range addrs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// printHandshakes prints how many handshakes had each outcome.
+func printHandshakes(w io.Writer, results []handshakeResult) {
+	var counts [numOutcomes]int
+	for _, r := range results {
+		counts[r.outcome]++
+	}
+	fmt.Fprintf(w, "Handshakes: %d/%d\n", counts[outcomeSuccess], len(results))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for o, n := range counts {
+		if outcome(o) == outcomeOther && n == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "  %s\t%d\n", outcome(o), n)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/harioms1522/BitSwift/internal/peer"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want outcome
+	}{
+		{nil, outcomeSuccess},
+		{peer.ErrInfoHashMismatch, outcomeInfoHashMismatch},
+		{peer.ErrProtocolMismatch, outcomeProtocolMismatch},
+		{peer.ErrHandshakeLength, outcomeProtocolMismatch},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, outcomeRefused},
+		{context.DeadlineExceeded, outcomeTimeout},
+		{fmt.Errorf("read: %w", os.ErrDeadlineExceeded), outcomeTimeout},
+		{io.EOF, outcomeOther},
+	}
+	for _, tt := range tests {
+		if got := classify(tt.err); got != tt.want {
+			t.Errorf("classify(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// fakeDialer connects each address to an in-memory peer that behaves as its name says.
+type fakeDialer struct {
+	infoHash [20]byte
+	active   atomic.Int32
+	peak     atomic.Int32
+}
+
+func (d *fakeDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if addr == "refused" {
+		return nil, &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	}
+	local, remote := net.Pipe()
+	n := d.active.Add(1)
+	for p := d.peak.Load(); n > p && !d.peak.CompareAndSwap(p, n); p = d.peak.Load() {
+	}
+	go func() {
+		defer remote.Close()
+		if _, err := io.ReadFull(remote, make([]byte, peer.HandshakeLen)); err != nil {
+			return
+		}
+		reply := &peer.Handshake{InfoHash: d.infoHash}
+		switch addr {
+		case "silent":
+			io.Copy(io.Discard, remote)
+			return
+		case "mismatch":
+			reply.InfoHash = [20]byte{9}
+		case "protocol":
+			remote.Write(bytes.Repeat([]byte{'x'}, peer.HandshakeLen))
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		remote.Write(reply.Encode())
+	}()
+	return &countedConn{Conn: local, active: &d.active}, nil
+}
+
+// countedConn decrements active when it is closed.
+type countedConn struct {
+	net.Conn
+	active *atomic.Int32
+	once   sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.active.Add(-1) })
+	return c.Conn.Close()
+}
+
+func TestHandshakeAll(t *testing.T) {
+	d := &fakeDialer{infoHash: [20]byte{1}}
+	addrs := []string{"ok1", "refused", "silent", "mismatch", "protocol", "ok2", "ok3", "ok4"}
+	our := &peer.Handshake{InfoHash: d.infoHash}
+	results := handshakeAll(context.Background(), d, addrs, our, 3, 200*time.Millisecond)
+
+	want := []outcome{outcomeSuccess, outcomeRefused, outcomeTimeout, outcomeInfoHashMismatch,
+		outcomeProtocolMismatch, outcomeSuccess, outcomeSuccess, outcomeSuccess}
+	for i, r := range results {
+		if r.addr != addrs[i] || r.outcome != want[i] {
+			t.Errorf("result %d = %s %v (%v), want %s %v", i, r.addr, r.outcome, r.err, addrs[i], want[i])
+		}
+	}
+	if p := d.peak.Load(); p > 3 || p < 2 {
+		t.Errorf("peak concurrency = %d, want 2 or 3", p)
+	}
+
+	var out bytes.Buffer
+	printHandshakes(&out, results)
+	wantOut := `Handshakes: 4/8
+  success             4
+  refused             1
+  timeout             1
+  info-hash mismatch  1
+  protocol mismatch   1
+`
+	if out.String() != wantOut {
+		t.Errorf("printHandshakes:\n%s\nwant:\n%s", out.String(), wantOut)
+	}
+}
+
+func TestHandshakeAll_Cancel(t *testing.T) {
+	d := &fakeDialer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	results := handshakeAll(ctx, d, []string{"silent", "silent", "silent"}, &peer.Handshake{}, 1, time.Minute)
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("took %v after cancel", time.Since(start))
+	}
+	for _, r := range results {
+		if !errors.Is(r.err, context.Canceled) {
+			t.Errorf("%s: err = %v, want context.Canceled", r.addr, r.err)
+		}
+	}
+}
@@ -3,55 +3,126 @@ package main
 import (
 	"context"
 	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/harioms1522/BitSwift/internal/download"
+	"github.com/harioms1522/BitSwift/internal/magnet"
+	"github.com/harioms1522/BitSwift/internal/metadata"
 	"github.com/harioms1522/BitSwift/internal/peer"
 	"github.com/harioms1522/BitSwift/internal/torrent"
 	"github.com/harioms1522/BitSwift/internal/tracker"
 )
 
 const (
-	defaultPort     = 6881
-	handshakeLimit  = 10
-	handshakeTimeout = 5 * time.Second
+	defaultPort        = 6881
+	handshakeLimit     = 10
+	defaultConcurrency = 5
+	handshakeTimeout   = 5 * time.Second
+	metadataTimeout    = 15 * time.Second
 )
 
+// commands are the subcommands selected by the first argument; anything else is a torrent
+// path or magnet URI.
+var commands = map[string]func(args []string, stdout io.Writer) error{
+	"create": runCreate,
+	"dump":   runDump,
+}
+
 func main() {
-	port := flag.Uint("p", defaultPort, "listen port to report to tracker")
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:], os.Stdout); err != nil {
+				if err != flag.ErrHelp {
+					fmt.Fprintf(os.Stderr, "bitswift: %v\n", err)
+				}
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	ports := flag.String("p", fmt.Sprint(defaultPort), "listen port or port range, e.g. 6881-6889; 0 picks any free port")
+	concurrency := flag.Int("j", defaultConcurrency, "handshake with up to this many peers at once")
+	output := flag.String("o", "", "download a single-file torrent into this directory")
 	flag.Parse()
+	firstPort, lastPort, err := peer.ParsePortRange(*ports)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bitswift: -p: %v\n", err)
+		os.Exit(1)
+	}
 	if flag.NArg() != 1 {
-		fmt.Fprintf(os.Stderr, "usage: bitswift [-p PORT] <path_to_torrent>\n")
+		fmt.Fprintf(os.Stderr, "usage: bitswift [-p PORT[-PORT]] [-j N] [-o DIR] <path_to_torrent|magnet_uri>\n")
+		fmt.Fprintf(os.Stderr, "       bitswift create [-a URL]... [-o FILE] <path>\n")
+		fmt.Fprintf(os.Stderr, "       bitswift dump [-format json|tree] [-bin hex|len] [-reverse] <file>\n")
 		os.Exit(1)
 	}
-	path := flag.Arg(0)
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "bitswift: file not found: %s\n", path)
-		} else {
+	arg := flag.Arg(0)
+	var (
+		infoHash    [20]byte
+		trackerURLs []string
+		left        int64
+		extraPeers  []string
+		mag         *magnet.Magnet
+		meta        *torrent.Meta // nil for a magnet URI until its metadata is fetched
+	)
+	if strings.HasPrefix(arg, "magnet:") {
+		m, err := magnet.Parse(arg)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "bitswift: %v\n", err)
+			os.Exit(1)
 		}
-		os.Exit(1)
+		printMagnetSummary(m)
+		mag = m
+		infoHash, trackerURLs, left, extraPeers = m.AnnounceHash(), m.Trackers, m.Length, m.Peers
+	} else {
+		meta = loadTorrent(arg)
+		printSummary(meta)
+		infoHash, trackerURLs, left = meta.InfoHash, meta.TrackerURLs(), meta.TotalSize()
 	}
-	meta, err := torrent.ParseFile(data)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "bitswift: %v\n", err)
-		os.Exit(1)
-	}
-	printSummary(meta)
 
 	peerID := makePeerID()
-	trackerURLs := meta.TrackerURLs()
 	if len(trackerURLs) == 0 {
 		fmt.Fprintf(os.Stderr, "bitswift: no announce URL in torrent\n")
 		os.Exit(1)
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
 	defer cancel()
-	resp, err := tracker.AnnounceWithRetry(ctx, trackerURLs, meta.InfoHash, peerID, uint16(*port), meta.TotalSize())
+
+	// Peers that learn about us from the tracker connect to the listener; the tracker is
+	// only told a port we actually listen on.
+	var (
+		inbound atomic.Int32
+		info    atomic.Pointer[[]byte] // our info dict, once known, served to peers that ask
+	)
+	if meta != nil {
+		b := []byte(meta.InfoBytes)
+		info.Store(&b)
+	}
+	l, err := peer.Listen("", firstPort, lastPort)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bitswift: listen: %v (use -p to pick other ports, or -p 0 for any)\n", err)
+		os.Exit(1)
+	}
+	l.PeerID = peerID
+	var ours peer.Handshake
+	ours.Set(peer.ExtensionProtocol)
+	l.Reserved = ours.Reserved
+	l.Register(infoHash, inboundHandler(ctx, &info, &inbound))
+	port := l.Port()
+	fmt.Println("Listening on port", port)
+	go l.Serve(ctx)
+
+	resp, err := tracker.AnnounceWithRetry(ctx, trackerURLs, infoHash, peerID, uint16(port), left)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "bitswift: tracker: %v\n", err)
 		os.Exit(1)
@@ -67,33 +138,205 @@ func main() {
 		fmt.Printf("  ... and %d more\n", len(resp.Peers)-10)
 	}
 
+	// Peers named in the magnet URI (x.pe) are tried before the tracker's.
+	addrs := extraPeers
+	for _, p := range resp.Peers {
+		addrs = append(addrs, fmt.Sprintf("%s:%d", p.IP, p.Port))
+	}
+	limit := handshakeLimit
+	if len(addrs) < limit {
+		limit = len(addrs)
+	}
+	if mag != nil {
+		m, addr, err := resolveMagnet(ctx, mag, addrs[:limit], peerID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bitswift: metadata: %v\n", err)
+		} else {
+			fmt.Println("Metadata from:", addr)
+			printSummary(m)
+			meta = m
+			b := []byte(m.InfoBytes)
+			info.Store(&b)
+		}
+	}
+
 	ourHandshake := &peer.Handshake{
-		InfoHash: meta.InfoHash,
+		InfoHash: infoHash,
 		PeerID:   peerID,
 	}
-	success := 0
-	limit := handshakeLimit
-	if len(resp.Peers) < limit {
-		limit = len(resp.Peers)
-	}
-	for i := 0; i < limit; i++ {
-		p := resp.Peers[i]
-		addr := fmt.Sprintf("%s:%d", p.IP, p.Port)
-		_, err := peer.DoHandshake(addr, ourHandshake, meta.InfoHash, handshakeTimeout)
-		if err == nil {
-			success++
+	results := handshakeAll(ctx, nil, addrs[:limit], ourHandshake, *concurrency, handshakeTimeout)
+	printHandshakes(os.Stdout, results)
+	fmt.Printf("Inbound peers: %d\n", inbound.Load())
+
+	if *output != "" {
+		if meta == nil {
+			fmt.Fprintf(os.Stderr, "bitswift: cannot download without the torrent's metadata\n")
+			os.Exit(1)
+		}
+		runDownload(meta, addrs, peerID, *output)
+	}
+}
+
+// inboundHandler counts the peers that connect to us and serves them our metadata
+// (BEP 9) once info holds it; other peers are hung up on, since there is nothing else to
+// serve yet.
+func inboundHandler(ctx context.Context, info *atomic.Pointer[[]byte], inbound *atomic.Int32) peer.Handler {
+	return func(conn net.Conn, remote *peer.Handshake) {
+		defer conn.Close()
+		inbound.Add(1)
+		data := info.Load()
+		if data == nil || !remote.Has(peer.ExtensionProtocol) {
+			return
+		}
+		metadata.Serve(ctx, conn, *data)
+	}
+}
+
+// runDownload downloads meta from addrs into dir, printing progress, and exits on error.
+func runDownload(meta *torrent.Meta, addrs []string, peerID [20]byte, dir string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var mu sync.Mutex
+	cfg := download.Config{
+		PeerID: peerID,
+		Progress: func(verified, total int) {
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Printf("\rDownloaded %d/%d pieces", verified, total)
+		},
+	}
+	path, err := download.Download(ctx, meta, addrs, dir, cfg)
+	fmt.Println()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bitswift: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Download complete:", path)
+}
+
+// loadTorrent reads and validates the torrent at path, exiting on error.
+func loadTorrent(path string) *torrent.Meta {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "bitswift: file not found: %s\n", path)
+		} else {
+			fmt.Fprintf(os.Stderr, "bitswift: %v\n", err)
+		}
+		os.Exit(1)
+	}
+	meta, err := torrent.ParseFile(data)
+	if err == nil {
+		err = meta.Validate()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bitswift: %v\n", err)
+		os.Exit(1)
+	}
+	return meta
+}
+
+// resolveMagnet fetches the info dictionary of m from the first of addrs that serves it
+// (BEP 9) and returns the torrent it describes, announced to the magnet's trackers.
+func resolveMagnet(ctx context.Context, m *magnet.Magnet, addrs []string, peerID [20]byte) (*torrent.Meta, string, error) {
+	our := &peer.Handshake{InfoHash: m.AnnounceHash(), PeerID: peerID}
+	our.Set(peer.ExtensionProtocol)
+	err := errors.New("no peers")
+	for _, addr := range addrs {
+		var info []byte
+		if info, err = fetchInfo(ctx, addr, our); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		meta, err := torrent.ParseInfo(info)
+		if err != nil {
+			return nil, "", err
 		}
+		if len(m.Trackers) > 0 {
+			meta.Announce = m.Trackers[0]
+			meta.AnnounceList = [][]string{m.Trackers}
+		}
+		return meta, addr, nil
+	}
+	return nil, "", err
+}
+
+func fetchInfo(ctx context.Context, addr string, our *peer.Handshake) ([]byte, error) {
+	hctx, hcancel := context.WithTimeout(ctx, handshakeTimeout)
+	conn, their, err := peer.DialContext(hctx, nil, addr, our, our.InfoHash)
+	hcancel()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if !their.Has(peer.ExtensionProtocol) {
+		return nil, metadata.ErrNotSupported
+	}
+	ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+	return metadata.Fetch(ctx, conn, our.InfoHash)
+}
+
+func printMagnetSummary(m *magnet.Magnet) {
+	if m.Name != "" {
+		fmt.Println("Name:", m.Name)
+	}
+	if m.HasV1() {
+		fmt.Println("Info hash:", hex.EncodeToString(m.InfoHash[:]))
 	}
-	fmt.Printf("Handshook: %d/%d\n", success, limit)
+	if m.HasV2() {
+		fmt.Println("Info hash v2:", hex.EncodeToString(m.InfoHashV2[:]))
+	}
+	if m.Length > 0 {
+		fmt.Println("Total size:", m.Length)
+	}
+	fmt.Println("Trackers:", len(m.Trackers))
 }
 
 func printSummary(meta *torrent.Meta) {
 	fmt.Println("Name:", meta.Info.Name)
+	if meta.Info.NameUTF8 != "" && meta.Info.NameUTF8 != meta.Info.Name {
+		fmt.Println("Name (UTF-8):", meta.Info.NameUTF8)
+	}
 	fmt.Println("Info hash:", meta.InfoHashHex())
+	switch {
+	case meta.IsHybrid():
+		fmt.Println("Version: hybrid v1/v2")
+		fmt.Println("Info hash v2:", meta.InfoHashV2Hex())
+	case meta.IsV2():
+		fmt.Println("Version: v2")
+		fmt.Println("Info hash v2:", meta.InfoHashV2Hex())
+	}
 	fmt.Println("Piece count:", meta.PieceCount())
 	fmt.Println("Piece length:", meta.Info.PieceLength)
 	fmt.Println("File count:", meta.FileCount())
 	fmt.Println("Total size:", meta.TotalSize())
+	if meta.Info.Private {
+		fmt.Println("Private: yes")
+	}
+	if meta.Info.Source != "" {
+		fmt.Println("Source:", meta.Info.Source)
+	}
+	if meta.Comment != "" {
+		fmt.Println("Comment:", meta.Comment)
+	}
+	if meta.CreatedBy != "" {
+		fmt.Println("Created by:", meta.CreatedBy)
+	}
+	if !meta.CreationDate.IsZero() {
+		fmt.Println("Creation date:", meta.CreationDate.Format(time.RFC3339))
+	}
+	if meta.Encoding != "" {
+		fmt.Println("Encoding:", meta.Encoding)
+	}
+	// Only the first tracker: a multi-tracker magnet URI can run to kilobytes.
+	m := magnet.FromMeta(meta)
+	if len(m.Trackers) > 1 {
+		m.Trackers = m.Trackers[:1]
+	}
+	fmt.Println("Magnet:", m)
 }
 
 func makePeerID() [20]byte {
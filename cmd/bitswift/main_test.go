@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/harioms1522/BitSwift/internal/metadata"
+	"github.com/harioms1522/BitSwift/internal/peer"
+	"github.com/harioms1522/BitSwift/internal/torrent"
+)
+
+func TestInboundHandler(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "valid.torrent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := torrent.ParseFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := peer.Listen("127.0.0.1", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.PeerID = [20]byte{'s'}
+	var ours peer.Handshake
+	ours.Set(peer.ExtensionProtocol)
+	l.Reserved = ours.Reserved
+	var (
+		inbound atomic.Int32
+		info    atomic.Pointer[[]byte]
+	)
+	l.Register(meta.InfoHash, inboundHandler(ctx, &info, &inbound))
+	go l.Serve(ctx)
+
+	fetch := func() ([]byte, error) {
+		our := &peer.Handshake{InfoHash: meta.InfoHash, PeerID: [20]byte{'c'}}
+		our.Set(peer.ExtensionProtocol)
+		conn, _, err := peer.DialContext(ctx, nil, l.Addr().String(), our, our.InfoHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return metadata.Fetch(ctx, conn, meta.InfoHash)
+	}
+
+	// Without metadata the peer is hung up on.
+	if _, err := fetch(); err == nil {
+		t.Error("Fetch succeeded before the metadata was known")
+	}
+	b := []byte(meta.InfoBytes)
+	info.Store(&b)
+	got, err := fetch()
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if !bytes.Equal(got, meta.InfoBytes) {
+		t.Error("fetched metadata differs from the info dict")
+	}
+	if inbound.Load() != 2 {
+		t.Errorf("inbound = %d, want 2", inbound.Load())
+	}
+}
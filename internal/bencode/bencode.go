@@ -1,8 +1,6 @@
 package bencode
 
 import (
-	"errors"
-	"fmt"
 	"strconv"
 )
 
@@ -13,33 +11,77 @@ type Value interface{}
 // It decodes integers, strings (as []byte), lists ([]interface{}), and dictionaries (map[string]interface{}).
 func Decode(data []byte) (Value, error) {
 	d := decoder{data: data}
-	return d.decode()
+	return d.decodeRoot()
 }
 
-// DecodeWithInfo parses bencoded data assumed to be a torrent root dict.
-// It returns the decoded value and the raw bencoded bytes of the "info" dict value, for computing info hash.
-// If the root is not a dict or has no "info" key, infoRaw is nil.
-func DecodeWithInfo(data []byte) (value Value, infoRaw []byte, err error) {
-	d := decoder{data: data, captureInfo: true}
-	value, err = d.decode()
+type decoder struct {
+	data   []byte
+	pos    int
+	depth  int
+	allocs int
+	opts   DecoderOptions
+	path   []pathElem // keys and indexes leading to the value being decoded
+}
+
+// decodeRoot decodes one value and records the key path of any error.
+func (d *decoder) decodeRoot() (Value, error) {
+	v, err := d.decode()
 	if err != nil {
-		return nil, nil, err
+		return nil, locate(err, 0, formatPath(d.path))
 	}
-	return value, d.infoRaw, nil
+	return v, nil
 }
 
-type decoder struct {
-	data        []byte
-	pos         int
-	captureInfo bool
-	infoRaw     []byte
-	depth       int
+func (d *decoder) syntaxError(kind ErrorKind, off int) error {
+	return &SyntaxError{Offset: off, Kind: kind}
+}
+
+func (d *decoder) push(e pathElem) {
+	d.path = append(d.path, e)
+}
+
+func (d *decoder) pop() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+// checkKey verifies that a dictionary key (a string) starts at the current position.
+func (d *decoder) checkKey() error {
+	if c := d.data[d.pos]; c < '0' || c > '9' {
+		return d.syntaxError(NonStringKey, d.pos)
+	}
+	return nil
+}
+
+// checkValue verifies that a dictionary value follows the key just read.
+func (d *decoder) checkValue() error {
+	if d.pos >= len(d.data) {
+		return d.syntaxError(UnexpectedEOF, d.pos)
+	}
+	if d.data[d.pos] == 'e' {
+		return d.syntaxError(MissingValue, d.pos)
+	}
+	return nil
+}
+
+// open enters a list or dictionary starting at the current position.
+func (d *decoder) open() error {
+	d.depth++
+	if err := checkDepth(&d.opts, d.depth, d.pos); err != nil {
+		return err
+	}
+	return d.alloc()
+}
+
+// alloc counts one allocated value against MaxTotalAllocs.
+func (d *decoder) alloc() error {
+	d.allocs++
+	return checkAllocs(&d.opts, d.allocs, d.pos)
 }
 
 func (d *decoder) decode() (Value, error) {
 
 	if d.pos >= len(d.data) {
-		return nil, errors.New("bencode: unexpected end of input")
+		return nil, d.syntaxError(UnexpectedEOF, d.pos)
 	}
 	switch d.data[d.pos] {
 	case 'i':
@@ -51,13 +93,13 @@ func (d *decoder) decode() (Value, error) {
 	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
 		return d.decodeString()
 	default:
-		return nil, fmt.Errorf("bencode: invalid character %q at position %d", d.data[d.pos], d.pos)
+		return nil, d.syntaxError(InvalidCharacter, d.pos)
 	}
 }
 
 func (d *decoder) decodeInt() (int64, error) {
 	if d.data[d.pos] != 'i' {
-		return 0, errors.New("bencode: expected 'i' for integer")
+		return 0, d.syntaxError(InvalidCharacter, d.pos)
 	}
 	d.pos++
 	start := d.pos
@@ -67,22 +109,37 @@ func (d *decoder) decodeInt() (int64, error) {
 			continue
 		}
 		if d.data[d.pos] < '0' || d.data[d.pos] > '9' {
-			return 0, fmt.Errorf("bencode: invalid integer at position %d", d.pos)
+			return 0, d.syntaxError(InvalidInteger, d.pos)
 		}
 		d.pos++
 	}
 	if d.pos >= len(d.data) {
-		return 0, errors.New("bencode: unexpected end of input in integer")
+		return 0, d.syntaxError(UnexpectedEOF, d.pos)
 	}
 	s := string(d.data[start:d.pos])
 	d.pos++ // consume 'e'
-	// Disallow leading zeros except for "0"
-	if len(s) > 1 && (s[0] == '0' || (s[0] == '-' && s[1] == '0')) {
-		return 0, fmt.Errorf("bencode: invalid integer (leading zero) %q", s)
+	return parseInt(s, start, d.opts.Strict)
+}
+
+// parseInt parses the digits of a bencoded integer (between 'i' and 'e') found at offset off.
+// "-0" and leading zeros are never valid; in strict mode they are reported as a CanonicalError.
+func parseInt(s string, off int, strict bool) (int64, error) {
+	var reason error
+	switch {
+	case len(s) > 1 && s[0] == '-' && s[1] == '0':
+		reason = ErrNegativeZero
+	case len(s) > 1 && s[0] == '0':
+		reason = ErrLeadingZero
+	}
+	if reason != nil {
+		if strict {
+			return 0, &CanonicalError{Offset: off, Err: reason}
+		}
+		return 0, &SyntaxError{Offset: off, Kind: InvalidInteger}
 	}
 	n, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
-		return 0, fmt.Errorf("bencode: invalid integer %q: %w", s, err)
+		return 0, &SyntaxError{Offset: off, Kind: InvalidInteger}
 	}
 	return n, nil
 }
@@ -92,39 +149,66 @@ func (d *decoder) decodeString() ([]byte, error) {
 	for d.pos < len(d.data) && d.data[d.pos] >= '0' && d.data[d.pos] <= '9' {
 		d.pos++
 	}
-	if d.pos >= len(d.data) || d.data[d.pos] != ':' {
-		return nil, fmt.Errorf("bencode: invalid string length at position %d", start)
+	if d.pos >= len(d.data) {
+		return nil, d.syntaxError(UnexpectedEOF, d.pos)
+	}
+	if d.data[d.pos] != ':' {
+		return nil, d.syntaxError(InvalidStringLength, start)
+	}
+	if err := checkLength(d.opts.Strict, d.data[start:d.pos], start); err != nil {
+		return nil, err
 	}
 	lenStr := string(d.data[start:d.pos])
 	length, err := strconv.Atoi(lenStr)
 	if err != nil || length < 0 {
-		return nil, fmt.Errorf("bencode: invalid string length %q", lenStr)
+		return nil, d.syntaxError(InvalidStringLength, start)
+	}
+	if err := checkStringLen(&d.opts, int64(length), start); err != nil {
+		return nil, err
+	}
+	if err := d.alloc(); err != nil {
+		return nil, err
 	}
 	d.pos++ // consume ':'
-	if d.pos+length > len(d.data) {
-		return nil, errors.New("bencode: string length exceeds input")
+	if length > len(d.data)-d.pos {
+		return nil, d.syntaxError(UnexpectedEOF, len(d.data))
+	}
+	var buf []byte
+	if d.opts.ZeroCopy {
+		// Cap the slice so appending to it cannot overwrite the rest of the input.
+		buf = d.data[d.pos : d.pos+length : d.pos+length]
+	} else {
+		buf = make([]byte, length)
+		copy(buf, d.data[d.pos:d.pos+length])
 	}
-	buf := make([]byte, length)
-	copy(buf, d.data[d.pos:d.pos+length])
 	d.pos += length
 	return buf, nil
 }
 
 func (d *decoder) decodeList() ([]Value, error) {
 	if d.data[d.pos] != 'l' {
-		return nil, errors.New("bencode: expected 'l' for list")
+		return nil, d.syntaxError(InvalidCharacter, d.pos)
+	}
+	if err := d.open(); err != nil {
+		return nil, err
 	}
 	d.pos++
 	var list []Value
 	for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+		if err := checkListLen(&d.opts, len(list)+1, d.pos); err != nil {
+			return nil, err
+		}
+		d.push(pathElem{index: len(list), isIndex: true})
 		v, err := d.decode()
 		if err != nil {
 			return nil, err
 		}
+		d.pop()
 		list = append(list, v)
 	}
+	d.depth--
 	if d.pos >= len(d.data) {
-		return nil, errors.New("bencode: unexpected end of input in list")
+		return nil, d.syntaxError(UnexpectedEOF, d.pos)
 	}
 	d.pos++ // consume 'e'
 	return list, nil
@@ -132,32 +216,44 @@ func (d *decoder) decodeList() ([]Value, error) {
 
 func (d *decoder) decodeDict() (map[string]Value, error) {
 	if d.data[d.pos] != 'd' {
-		return nil, errors.New("bencode: expected 'd' for dictionary")
+		return nil, d.syntaxError(InvalidCharacter, d.pos)
+	}
+	if err := d.open(); err != nil {
+		return nil, err
 	}
 	d.pos++
 	dict := make(map[string]Value)
-	topLevel := d.depth == 0
-	d.depth++
-	for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+	var prev []byte
+	for n := 1; d.pos < len(d.data) && d.data[d.pos] != 'e'; n++ {
+		keyStart := d.pos
+		if err := checkListLen(&d.opts, n, keyStart); err != nil {
+			return nil, err
+		}
+		if err := d.checkKey(); err != nil {
+			return nil, err
+		}
 		key, err := d.decodeString()
 		if err != nil {
 			return nil, err
 		}
-		keyStr := string(key)
-		infoStart := d.pos
+		if err := checkKeyOrder(d.opts.Strict, prev, key, n > 1, keyStart); err != nil {
+			return nil, err
+		}
+		prev = key
+		d.push(pathElem{key: key})
+		if err := d.checkValue(); err != nil {
+			return nil, err
+		}
 		v, err := d.decode()
 		if err != nil {
 			return nil, err
 		}
-		if d.captureInfo && topLevel && keyStr == "info" {
-			d.infoRaw = make([]byte, d.pos-infoStart)
-			copy(d.infoRaw, d.data[infoStart:d.pos])
-		}
-		dict[keyStr] = v
+		d.pop()
+		dict[string(key)] = v
 	}
 	d.depth--
 	if d.pos >= len(d.data) {
-		return nil, errors.New("bencode: unexpected end of input in dictionary")
+		return nil, d.syntaxError(UnexpectedEOF, d.pos)
 	}
 	d.pos++ // consume 'e'
 	return dict, nil
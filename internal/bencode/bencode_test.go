@@ -1,7 +1,8 @@
 package bencode
 
 import (
-	"reflect"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -151,23 +152,6 @@ func TestDecodeNested(t *testing.T) {
 	}
 }
 
-func TestDecodeWithInfo(t *testing.T) {
-	// Root dict with "info" key; we want raw info bytes for hashing.
-	input := []byte("d4:infod6:lengthi100e4:name4:testee")
-	_, infoRaw, err := DecodeWithInfo(input)
-	if err != nil {
-		t.Fatalf("DecodeWithInfo: %v", err)
-	}
-	if infoRaw == nil {
-		t.Fatal("infoRaw is nil")
-	}
-	// Raw info should be "d6:lengthi100e4:name4:teste"
-	want := []byte("d6:lengthi100e4:name4:teste")
-	if !reflect.DeepEqual(infoRaw, want) {
-		t.Errorf("infoRaw = %q, want %q", infoRaw, want)
-	}
-}
-
 func TestDecodeInvalid(t *testing.T) {
 	invalid := []string{"", "x", "i", "4:ab", "l", "d"}
 	for _, input := range invalid {
@@ -177,3 +161,61 @@ func TestDecodeInvalid(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodeZeroCopy(t *testing.T) {
+	input := []byte("d4:name4:test6:piecesl3:abcee")
+	v, err := DecodeWithOptions(input, DecoderOptions{ZeroCopy: true})
+	if err != nil {
+		t.Fatalf("DecodeWithOptions: %v", err)
+	}
+	name := v.(map[string]Value)["name"].([]byte)
+	if &name[0] != &input[9] {
+		t.Error("ZeroCopy string does not alias the input")
+	}
+	if cap(name) != len(name) {
+		t.Errorf("cap(name) = %d, want %d so appends cannot clobber the input", cap(name), len(name))
+	}
+
+	var st struct {
+		Name   []byte   `bencode:"name"`
+		Pieces [][]byte `bencode:"pieces"`
+	}
+	if err := UnmarshalWithOptions(input, &st, DecoderOptions{ZeroCopy: true}); err != nil {
+		t.Fatalf("UnmarshalWithOptions: %v", err)
+	}
+	if &st.Pieces[0][0] != &input[24] {
+		t.Error("ZeroCopy []byte field does not alias the input")
+	}
+
+	// Without the option, values never alias the input.
+	v, _ = Decode(input)
+	if &v.(map[string]Value)["name"].([]byte)[0] == &input[9] {
+		t.Error("Decode aliases the input")
+	}
+}
+
+func benchmarkTestdata(b *testing.B, opts DecoderOptions) {
+	for _, name := range []string{"valid.torrent", "game.torrent", "ubuntu-24.04.3-desktop-amd64.iso.torrent"} {
+		data, err := os.ReadFile(filepath.Join("..", "..", "testdata", name))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := DecodeWithOptions(data, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	benchmarkTestdata(b, DecoderOptions{})
+}
+
+func BenchmarkDecodeZeroCopy(b *testing.B) {
+	benchmarkTestdata(b, DecoderOptions{ZeroCopy: true})
+}
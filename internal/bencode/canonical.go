@@ -0,0 +1,76 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Reasons a well-formed input is not canonical bencode, carried by CanonicalError.
+var (
+	ErrUnsortedKeys = errors.New("dictionary keys not sorted")
+	ErrDuplicateKey = errors.New("duplicate dictionary key")
+	ErrTrailingData = errors.New("trailing data after root value")
+	ErrNegativeZero = errors.New("negative zero integer")
+	ErrLeadingZero  = errors.New("leading zero in number")
+)
+
+// CanonicalError reports input that does not have a single canonical encoding, such as
+// unsorted dictionary keys. Use errors.Is with the Err* reasons above to tell them apart.
+type CanonicalError struct {
+	Offset int    // byte offset of the offending key, number or trailing data
+	Path   string // key path of the enclosing value; empty at the root
+	Err    error  // one of the Err* reasons
+}
+
+func (e *CanonicalError) Error() string {
+	return fmt.Sprintf("bencode: non-canonical input at position %d%s: %v", e.Offset, inPath(e.Path), e.Err)
+}
+
+func (e *CanonicalError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeStrict is like Decode but rejects any input that is not canonical: unsorted or
+// duplicate dictionary keys, leading zeros in string lengths, and data after the root value.
+// Two different inputs accepted by DecodeStrict never decode to the same Value, which is what
+// makes info hashes unambiguous.
+func DecodeStrict(data []byte) (Value, error) {
+	return DecodeWithOptions(data, DecoderOptions{Strict: true})
+}
+
+// UnmarshalStrict is like Unmarshal but applies the canonical checks of DecodeStrict.
+func UnmarshalStrict(data []byte, v any) error {
+	return UnmarshalWithOptions(data, v, DecoderOptions{Strict: true})
+}
+
+// checkEnd rejects trailing data after the root value.
+func (d *decoder) checkEnd() error {
+	if d.pos != len(d.data) {
+		return &CanonicalError{Offset: d.pos, Err: ErrTrailingData}
+	}
+	return nil
+}
+
+// checkKeyOrder verifies that key, at offset off, sorts strictly after the previous key
+// of the same dictionary. It is a no-op unless strict checking is enabled.
+func checkKeyOrder(strict bool, prev, key []byte, hasPrev bool, off int) error {
+	if !strict || !hasPrev {
+		return nil
+	}
+	switch c := bytes.Compare(prev, key); {
+	case c == 0:
+		return &CanonicalError{Offset: off, Err: ErrDuplicateKey}
+	case c > 0:
+		return &CanonicalError{Offset: off, Err: ErrUnsortedKeys}
+	}
+	return nil
+}
+
+// checkLength rejects a string length prefix with leading zeros, such as "04:spam".
+func checkLength(strict bool, digits []byte, off int) error {
+	if strict && len(digits) > 1 && digits[0] == '0' {
+		return &CanonicalError{Offset: off, Err: ErrLeadingZero}
+	}
+	return nil
+}
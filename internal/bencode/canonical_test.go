@@ -0,0 +1,110 @@
+package bencode
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeStrictRejectsNonCanonical(t *testing.T) {
+	tests := []struct {
+		input  string
+		reason error
+		offset int
+	}{
+		{"d1:bi1e1:ai2ee", ErrUnsortedKeys, 7},
+		{"d1:ai1e1:ai2ee", ErrDuplicateKey, 7},
+		{"d2:abi1e1:ai2ee", ErrUnsortedKeys, 8},
+		{"ld1:bi1e1:ai2eee", ErrUnsortedKeys, 8},
+		{"i1ei2e", ErrTrailingData, 3},
+		{"de ", ErrTrailingData, 2},
+		{"i-0e", ErrNegativeZero, 1},
+		{"i-01e", ErrNegativeZero, 1},
+		{"i007e", ErrLeadingZero, 1},
+		{"04:spam", ErrLeadingZero, 0},
+		{"d04:spami1ee", ErrLeadingZero, 1},
+	}
+	for _, tt := range tests {
+		_, err := DecodeStrict([]byte(tt.input))
+		if !errors.Is(err, tt.reason) {
+			t.Errorf("DecodeStrict(%q) = %v, want %v", tt.input, err, tt.reason)
+			continue
+		}
+		var ce *CanonicalError
+		if !errors.As(err, &ce) || ce.Offset != tt.offset {
+			t.Errorf("DecodeStrict(%q) offset = %v, want %d", tt.input, err, tt.offset)
+		}
+	}
+}
+
+func TestDecodeLenientStillAccepts(t *testing.T) {
+	// The default decoder keeps accepting these for compatibility with sloppy encoders.
+	for _, input := range []string{"d1:bi1e1:ai2ee", "d1:ai1e1:ai2ee", "i1ei2e", "04:spam"} {
+		if _, err := Decode([]byte(input)); err != nil {
+			t.Errorf("Decode(%q): %v", input, err)
+		}
+	}
+	// Negative zero and leading zeros are never valid; outside strict mode they are syntax errors.
+	for _, input := range []string{"i-0e", "i03e"} {
+		var se *SyntaxError
+		if _, err := Decode([]byte(input)); !errors.As(err, &se) || se.Kind != InvalidInteger || se.Offset != 1 {
+			t.Errorf("Decode(%q) = %v, want an InvalidInteger SyntaxError at 1", input, err)
+		}
+	}
+}
+
+func TestDecodeStrictAcceptsCanonical(t *testing.T) {
+	for _, name := range []string{"valid.torrent", "game.torrent"} {
+		data, err := os.ReadFile(filepath.Join("..", "..", "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeStrict(data); err != nil {
+			t.Errorf("DecodeStrict(%s): %v", name, err)
+		}
+	}
+	if _, err := DecodeStrict([]byte("d0:i1e1:ai2ee")); err != nil {
+		t.Errorf("DecodeStrict with empty first key: %v", err)
+	}
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	var st struct {
+		A int `bencode:"a"`
+		B int `bencode:"b"`
+	}
+	if err := UnmarshalStrict([]byte("d1:ai1e1:bi2ee"), &st); err != nil || st.A != 1 || st.B != 2 {
+		t.Fatalf("UnmarshalStrict = %+v, %v", st, err)
+	}
+	if err := UnmarshalStrict([]byte("d1:bi2e1:ai1ee"), &st); !errors.Is(err, ErrUnsortedKeys) {
+		t.Errorf("UnmarshalStrict unsorted = %v, want ErrUnsortedKeys", err)
+	}
+	// Keys skipped because no field matches are still checked.
+	if err := UnmarshalStrict([]byte("d1:ai1e1:xi1e1:xi1ee"), &st); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("UnmarshalStrict duplicate = %v, want ErrDuplicateKey", err)
+	}
+	if err := UnmarshalStrict([]byte("d1:ai1eex"), &st); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("UnmarshalStrict trailing = %v, want ErrTrailingData", err)
+	}
+}
+
+func TestDecoderDisallowNonCanonical(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("d1:ai1e1:ai2ee"))
+	dec.DisallowNonCanonical()
+	var err error
+	for err == nil {
+		_, err = dec.Token()
+	}
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("Token = %v, want ErrDuplicateKey", err)
+	}
+
+	dec = NewDecoder(strings.NewReader("d1:bi1e1:ai2ee"))
+	dec.DisallowNonCanonical()
+	var v Value
+	if err := dec.Decode(&v); !errors.Is(err, ErrUnsortedKeys) {
+		t.Errorf("Decode = %v, want ErrUnsortedKeys", err)
+	}
+}
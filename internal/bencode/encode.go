@@ -0,0 +1,90 @@
+package bencode
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Encode returns the canonical bencoding of v.
+// Supported types are int64 (and int), []byte, string, []Value and map[string]Value.
+// Dictionary keys are written in sorted order (compared as raw byte strings).
+func Encode(v Value) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := EncodeTo(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeTo writes the canonical bencoding of v to w.
+func EncodeTo(w io.Writer, v Value) error {
+	var e encoder
+	if err := e.encode(v); err != nil {
+		return err
+	}
+	_, err := w.Write(e.buf)
+	return err
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) encode(v Value) error {
+	switch x := v.(type) {
+	case int64:
+		e.writeInt(x)
+	case int:
+		e.writeInt(int64(x))
+	case []byte:
+		e.writeBytes(x)
+	case string:
+		e.writeString(x)
+	case []Value:
+		e.buf = append(e.buf, 'l')
+		for _, item := range x {
+			if err := e.encode(item); err != nil {
+				return err
+			}
+		}
+		e.buf = append(e.buf, 'e')
+	case map[string]Value:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		e.buf = append(e.buf, 'd')
+		for _, k := range keys {
+			e.writeString(k)
+			if err := e.encode(x[k]); err != nil {
+				return err
+			}
+		}
+		e.buf = append(e.buf, 'e')
+	default:
+		return fmt.Errorf("bencode: cannot encode value of type %T", v)
+	}
+	return nil
+}
+
+func (e *encoder) writeInt(n int64) {
+	e.buf = append(e.buf, 'i')
+	e.buf = strconv.AppendInt(e.buf, n, 10)
+	e.buf = append(e.buf, 'e')
+}
+
+func (e *encoder) writeBytes(b []byte) {
+	e.buf = strconv.AppendInt(e.buf, int64(len(b)), 10)
+	e.buf = append(e.buf, ':')
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) writeString(s string) {
+	e.buf = strconv.AppendInt(e.buf, int64(len(s)), 10)
+	e.buf = append(e.buf, ':')
+	e.buf = append(e.buf, s...)
+}
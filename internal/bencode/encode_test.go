@@ -0,0 +1,92 @@
+package bencode
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		input Value
+		want  string
+	}{
+		{"zero", int64(0), "i0e"},
+		{"positive", int64(42), "i42e"},
+		{"negative", int64(-42), "i-42e"},
+		{"int", 7, "i7e"},
+		{"empty string", []byte{}, "0:"},
+		{"bytes", []byte("spam"), "4:spam"},
+		{"string", "bencode", "7:bencode"},
+		{"empty list", []Value{}, "le"},
+		{"list", []Value{[]byte("spam"), int64(-20)}, "l4:spami-20ee"},
+		{"empty dict", map[string]Value{}, "de"},
+		{"nested", map[string]Value{
+			"info": map[string]Value{"name": "test", "length": int64(100)},
+		}, "d4:infod6:lengthi100e4:name4:testee"},
+	}
+	for _, tt := range tests {
+		got, err := Encode(tt.input)
+		if err != nil {
+			t.Errorf("%s: Encode: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: Encode = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeSortsKeysAsBytes(t *testing.T) {
+	// Uppercase sorts before lowercase, and a prefix sorts before its extensions.
+	v := map[string]Value{"b": int64(2), "a": int64(1), "ab": int64(3), "B": int64(4)}
+	got, err := Encode(v)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	want := "d1:Bi4e1:ai1e2:abi3e1:bi2ee"
+	if string(got) != want {
+		t.Errorf("Encode = %q, want %q", got, want)
+	}
+}
+
+func TestEncodeUnsupportedType(t *testing.T) {
+	for _, v := range []Value{nil, 1.5, true, []string{"a"}} {
+		if _, err := Encode(v); err == nil {
+			t.Errorf("Encode(%T) expected error, got nil", v)
+		}
+	}
+}
+
+func TestEncodeTo(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeTo(&buf, []Value{int64(1), "x"}); err != nil {
+		t.Fatalf("EncodeTo: %v", err)
+	}
+	if buf.String() != "li1e1:xe" {
+		t.Errorf("EncodeTo wrote %q", buf.String())
+	}
+}
+
+func TestEncodeRoundTripTestdata(t *testing.T) {
+	files := []string{"valid.torrent", "game.torrent", "ubuntu-24.04.3-desktop-amd64.iso.torrent"}
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join("..", "..", "testdata", name))
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		v, err := Decode(data)
+		if err != nil {
+			t.Fatalf("Decode(%s): %v", name, err)
+		}
+		got, err := Encode(v)
+		if err != nil {
+			t.Fatalf("Encode(%s): %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: Encode(Decode(x)) differs from x (%d vs %d bytes)", name, len(got), len(data))
+		}
+	}
+}
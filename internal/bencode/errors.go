@@ -0,0 +1,125 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrorKind classifies a SyntaxError.
+type ErrorKind int
+
+const (
+	UnexpectedEOF       ErrorKind = iota + 1 // input ends inside a value
+	InvalidCharacter                         // byte cannot start a value
+	InvalidInteger                           // malformed or out-of-range integer
+	InvalidStringLength                      // malformed string length prefix
+	NonStringKey                             // dictionary key is not a string
+	MissingValue                             // dictionary key has no value
+	UnexpectedEnd                            // 'e' outside any list or dictionary
+)
+
+var errorKindNames = map[ErrorKind]string{
+	UnexpectedEOF:       "unexpected end of input",
+	InvalidCharacter:    "invalid character",
+	InvalidInteger:      "invalid integer",
+	InvalidStringLength: "invalid string length",
+	NonStringKey:        "dictionary key is not a string",
+	MissingValue:        "dictionary key without value",
+	UnexpectedEnd:       "unexpected end of container",
+}
+
+func (k ErrorKind) String() string {
+	if s, ok := errorKindNames[k]; ok {
+		return s
+	}
+	return "ErrorKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// SyntaxError describes malformed bencode input.
+type SyntaxError struct {
+	Offset int       // byte offset of the error in the input
+	Path   string    // key path of the enclosing value, e.g. "info.files[3].path[1]"; empty at the root
+	Kind   ErrorKind // what is wrong
+}
+
+func (e *SyntaxError) Error() string {
+	return "bencode: " + e.Kind.String() + " at position " + strconv.Itoa(e.Offset) + inPath(e.Path)
+}
+
+// Unwrap lets errors.Is(err, io.ErrUnexpectedEOF) detect truncated input.
+func (e *SyntaxError) Unwrap() error {
+	if e.Kind == UnexpectedEOF {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func inPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	return " (in " + path + ")"
+}
+
+// pathElem is one step of a key path: a dictionary key, or a list index when isIndex is set.
+type pathElem struct {
+	key     []byte
+	index   int
+	isIndex bool
+}
+
+func formatPath(elems []pathElem) string {
+	var b strings.Builder
+	for _, e := range elems {
+		if e.isIndex {
+			fmt.Fprintf(&b, "[%d]", e.index)
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.Write(e.key)
+	}
+	return b.String()
+}
+
+func joinPath(prefix, path string) string {
+	switch {
+	case prefix == "":
+		return path
+	case path == "":
+		return prefix
+	case path[0] == '[':
+		return prefix + path
+	}
+	return prefix + "." + path
+}
+
+// locate records where a decode error happened inside a nested value: base is added to its
+// offset and prefix is prepended to its key path. Errors of other types are returned unchanged.
+func locate(err error, base int, prefix string) error {
+	var (
+		se *SyntaxError
+		ce *CanonicalError
+		le *LimitError
+		te *UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &se):
+		se.Offset += base
+		se.Path = joinPath(prefix, se.Path)
+	case errors.As(err, &ce):
+		ce.Offset += base
+		ce.Path = joinPath(prefix, ce.Path)
+	case errors.As(err, &le):
+		le.Offset += base
+		le.Path = joinPath(prefix, le.Path)
+	case errors.As(err, &te):
+		te.Offset += base
+		te.Path = joinPath(prefix, te.Path)
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package bencode
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSyntaxErrorKinds(t *testing.T) {
+	tests := []struct {
+		input      string
+		kind       ErrorKind
+		offset     int
+		path       string
+		streamPath string // the stream decoder also names the list element it expected
+	}{
+		{"", UnexpectedEOF, 0, "", ""},
+		{"x", InvalidCharacter, 0, "", ""},
+		{"i12", UnexpectedEOF, 3, "", ""},
+		{"i1x2e", InvalidInteger, 2, "", ""},
+		{"i99999999999999999999e", InvalidInteger, 1, "", ""},
+		{"4:ab", UnexpectedEOF, 4, "", ""},
+		{"4x", InvalidStringLength, 0, "", ""},
+		{"di1ei2ee", NonStringKey, 1, "", ""},
+		{"d1:ae", MissingValue, 4, "a", ""},
+		{"l", UnexpectedEOF, 1, "", "[0]"},
+		{"li1ex", InvalidCharacter, 4, "[1]", ""},
+		{"d4:infod5:filesld4:pathl1:ax:eeeeee", InvalidCharacter, 27, "info.files[0].path[1]", ""},
+		{"d4:infod4:name", UnexpectedEOF, 14, "info.name", ""},
+	}
+	for _, tt := range tests {
+		for _, mode := range []string{"Decode", "Unmarshal", "Decoder"} {
+			var err error
+			switch mode {
+			case "Decode":
+				_, err = Decode([]byte(tt.input))
+			case "Unmarshal":
+				var v Value
+				err = Unmarshal([]byte(tt.input), &v)
+			case "Decoder":
+				if tt.input == "" {
+					continue // an empty stream is a clean io.EOF
+				}
+				var v Value
+				err = NewDecoder(strings.NewReader(tt.input)).Decode(&v)
+				if tt.streamPath != "" {
+					tt.path = tt.streamPath
+				}
+			}
+			var se *SyntaxError
+			if !errors.As(err, &se) {
+				t.Errorf("%s(%q) = %v, want *SyntaxError", mode, tt.input, err)
+				continue
+			}
+			if se.Kind != tt.kind || se.Offset != tt.offset || se.Path != tt.path {
+				t.Errorf("%s(%q) = {%v, %d, %q}, want {%v, %d, %q}",
+					mode, tt.input, se.Kind, se.Offset, se.Path, tt.kind, tt.offset, tt.path)
+			}
+		}
+	}
+}
+
+func TestSyntaxErrorMessage(t *testing.T) {
+	_, err := Decode([]byte("d4:infod4:name"))
+	want := "bencode: unexpected end of input at position 14 (in info.name)"
+	if err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %q", err, want)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("truncated input should match io.ErrUnexpectedEOF")
+	}
+}
+
+func TestErrorPaths(t *testing.T) {
+	// Type, canonical and limit errors carry the key path too.
+	var st struct {
+		Info struct {
+			Files []struct {
+				Length int64 `bencode:"length"`
+			} `bencode:"files"`
+		} `bencode:"info"`
+	}
+	err := Unmarshal([]byte("d4:infod5:filesld6:lengthi1eed6:length1:xeeee"), &st)
+	var te *UnmarshalTypeError
+	if !errors.As(err, &te) || te.Path != "info.files[1].length" || te.Offset != 38 {
+		t.Errorf("type error = %v, want path info.files[1].length at 38", err)
+	}
+
+	_, err = DecodeStrict([]byte("d1:ad1:bi1e1:ai2eee"))
+	var ce *CanonicalError
+	if !errors.As(err, &ce) || ce.Path != "a" {
+		t.Errorf("canonical error = %v, want path a", err)
+	}
+
+	_, err = DecodeWithOptions([]byte("d1:ald1:x3:abceee"), DecoderOptions{MaxStringLen: 2})
+	var le *LimitError
+	if !errors.As(err, &le) || le.Path != "a[0].x" {
+		t.Errorf("limit error = %v, want path a[0].x", err)
+	}
+}
+
+type failingField struct{}
+
+func (*failingField) UnmarshalBencode(data []byte) error {
+	var n int
+	return Unmarshal(data, &n)
+}
+
+func TestErrorInsideUnmarshaler(t *testing.T) {
+	// Errors from a nested Unmarshal are reported at their position in the outer input.
+	var st struct {
+		F failingField `bencode:"f"`
+	}
+	err := Unmarshal([]byte("d1:f3:abce"), &st)
+	var te *UnmarshalTypeError
+	if !errors.As(err, &te) || te.Offset != 4 || te.Path != "f" {
+		t.Errorf("error = %v, want offset 4 path f", err)
+	}
+}
+
+func TestDecoderErrorOffsets(t *testing.T) {
+	// Offsets from Decoder.Decode are relative to the whole stream.
+	dec := NewDecoder(strings.NewReader("i1e" + "d1:al1:x1:yee" + "d1:ai1x"))
+	var v Value
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	var st struct {
+		A []int `bencode:"a"`
+	}
+	err := dec.Decode(&st)
+	var te *UnmarshalTypeError
+	if !errors.As(err, &te) || te.Offset != 8 || te.Path != "a[0]" {
+		t.Errorf("Decode = %v, want offset 8 path a[0]", err)
+	}
+	err = dec.Decode(&v)
+	var se *SyntaxError
+	if !errors.As(err, &se) || se.Offset != 22 || se.Path != "a" || se.Kind != InvalidInteger {
+		t.Errorf("Decode = %v, want invalid integer at 22 in a", err)
+	}
+}
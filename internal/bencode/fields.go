@@ -0,0 +1,126 @@
+package bencode
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// field describes one struct field that maps to a bencode dictionary key.
+type field struct {
+	name      string // dictionary key
+	index     []int  // index sequence for reflect.Value.FieldByIndex
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// cachedFields returns the bencode fields of struct type t, sorted by key.
+// Keys come from the `bencode:"key,omitempty"` tag, or the Go field name when untagged.
+// Fields tagged "-" and unexported fields are ignored. Untagged embedded structs are flattened;
+// when several fields share a key, Go's rules pick one: the shallowest wins, then a tagged
+// field over untagged ones, and a key still ambiguous after that is ignored.
+func cachedFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+	f, _ := fieldCache.LoadOrStore(t, dominantFields(typeFields(t, nil)))
+	return f.([]field)
+}
+
+// candidate is a field that may map to its key, before conflicts with other fields are resolved.
+type candidate struct {
+	field
+	tagged bool
+}
+
+// typeFields returns every candidate field of t, including the ones nested in embedded structs.
+func typeFields(t reflect.Type, prefix []int) []candidate {
+	var fields []candidate
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("bencode")
+		if tag == "-" {
+			continue
+		}
+		index := make([]int, len(prefix)+1)
+		copy(index, prefix)
+		index[len(prefix)] = i
+		if sf.Anonymous && tag == "" && sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, typeFields(sf.Type, index)...)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		tagged := name != ""
+		if !tagged {
+			name = sf.Name
+		}
+		fields = append(fields, candidate{
+			field:  field{name: name, index: index, omitEmpty: opts == "omitempty"},
+			tagged: tagged,
+		})
+	}
+	return fields
+}
+
+// dominantFields resolves fields sharing a key and returns the winners sorted by key.
+func dominantFields(cands []candidate) []field {
+	byName := make(map[string][]candidate)
+	var names []string
+	for _, c := range cands {
+		if _, ok := byName[c.name]; !ok {
+			names = append(names, c.name)
+		}
+		byName[c.name] = append(byName[c.name], c)
+	}
+	var fields []field
+	for _, name := range names {
+		if f, ok := dominantField(byName[name]); ok {
+			fields = append(fields, f)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].name < fields[j].name })
+	return fields
+}
+
+// dominantField picks the field that wins among cands, which share a key, or reports that none does.
+func dominantField(cands []candidate) (field, bool) {
+	depth := len(cands[0].index)
+	for _, c := range cands {
+		depth = min(depth, len(c.index))
+	}
+	var best []candidate
+	for _, c := range cands {
+		if len(c.index) == depth {
+			best = append(best, c)
+		}
+	}
+	if len(best) > 1 {
+		var tagged []candidate
+		for _, c := range best {
+			if c.tagged {
+				tagged = append(tagged, c)
+			}
+		}
+		if len(tagged) > 0 {
+			best = tagged
+		}
+	}
+	if len(best) > 1 {
+		return field{}, false
+	}
+	return best[0].field, true
+}
+
+// fieldByName returns the field with the given key, or nil.
+func fieldByName(fields []field, name string) *field {
+	i := sort.Search(len(fields), func(i int) bool { return fields[i].name >= name })
+	if i < len(fields) && fields[i].name == name {
+		return &fields[i]
+	}
+	return nil
+}
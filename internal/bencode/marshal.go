@@ -0,0 +1,177 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// Marshaler is implemented by types that can encode themselves as a single bencoded value.
+type Marshaler interface {
+	MarshalBencode() ([]byte, error)
+}
+
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+// Marshal returns the canonical bencoding of v.
+//
+// Integers and bools (as 0 or 1) encode as bencode integers; strings, []byte and [N]byte as
+// byte strings; other slices and arrays as lists; maps with string keys and structs as
+// dictionaries with sorted keys. Struct fields are named by the `bencode:"key,omitempty"` tag.
+// Nil pointers and interfaces inside structs, lists and maps are omitted, since bencode has no null.
+func Marshal(v any) ([]byte, error) {
+	var e encoder
+	if err := e.marshal(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+func (e *encoder) marshal(v reflect.Value) error {
+	if !v.IsValid() {
+		return errors.New("bencode: cannot marshal nil value")
+	}
+	if v.Type().Implements(marshalerType) {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return errors.New("bencode: cannot marshal nil pointer")
+		}
+		return e.marshalWith(v.Interface().(Marshaler))
+	}
+	if v.Kind() != reflect.Pointer && v.CanAddr() && v.Addr().Type().Implements(marshalerType) {
+		return e.marshalWith(v.Addr().Interface().(Marshaler))
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.buf = append(e.buf, 'i')
+		e.buf = strconv.AppendUint(e.buf, v.Uint(), 10)
+		e.buf = append(e.buf, 'e')
+	case reflect.Bool:
+		if v.Bool() {
+			e.writeInt(1)
+		} else {
+			e.writeInt(0)
+		}
+	case reflect.String:
+		e.writeString(v.String())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.writeBytes(v.Bytes())
+			return nil
+		}
+		return e.marshalList(v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			e.writeBytes(b)
+			return nil
+		}
+		return e.marshalList(v)
+	case reflect.Map:
+		return e.marshalMap(v)
+	case reflect.Struct:
+		return e.marshalStruct(v)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return errors.New("bencode: cannot marshal nil value")
+		}
+		return e.marshal(v.Elem())
+	default:
+		return fmt.Errorf("bencode: cannot marshal value of type %s", v.Type())
+	}
+	return nil
+}
+
+func (e *encoder) marshalWith(m Marshaler) error {
+	b, err := m.MarshalBencode()
+	if err != nil {
+		return err
+	}
+	d := decoder{data: b}
+	if _, err := d.decode(); err != nil || d.pos != len(b) {
+		return fmt.Errorf("bencode: MarshalBencode of %T returned invalid bencode", m)
+	}
+	e.buf = append(e.buf, b...)
+	return nil
+}
+
+func (e *encoder) marshalList(v reflect.Value) error {
+	e.buf = append(e.buf, 'l')
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i)
+		if isNilRef(item) {
+			continue
+		}
+		if err := e.marshal(item); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, 'e')
+	return nil
+}
+
+func (e *encoder) marshalMap(v reflect.Value) error {
+	if v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("bencode: unsupported map key type %s", v.Type().Key())
+	}
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	e.buf = append(e.buf, 'd')
+	for _, k := range keys {
+		item := v.MapIndex(k)
+		if isNilRef(item) {
+			continue
+		}
+		e.writeString(k.String())
+		if err := e.marshal(item); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, 'e')
+	return nil
+}
+
+func (e *encoder) marshalStruct(v reflect.Value) error {
+	e.buf = append(e.buf, 'd')
+	for _, f := range cachedFields(v.Type()) {
+		fv := v.FieldByIndex(f.index)
+		if isNilRef(fv) || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		e.writeString(f.name)
+		if err := e.marshal(fv); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, 'e')
+	return nil
+}
+
+func isNilRef(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package bencode
+
+import (
+	"errors"
+	"testing"
+)
+
+type marshalFile struct {
+	Path   []string `bencode:"path"`
+	Length int64    `bencode:"length"`
+}
+
+type marshalInfo struct {
+	Name        string        `bencode:"name"`
+	PieceLength int64         `bencode:"piece length"`
+	Pieces      []byte        `bencode:"pieces"`
+	Length      int64         `bencode:"length,omitempty"`
+	Files       []marshalFile `bencode:"files,omitempty"`
+	Private     bool          `bencode:"private,omitempty"`
+}
+
+type marshalMeta struct {
+	Announce string      `bencode:"announce"`
+	Comment  *string     `bencode:"comment"`
+	Info     marshalInfo `bencode:"info"`
+	Skipped  string      `bencode:"-"`
+	internal int
+}
+
+func TestMarshalStruct(t *testing.T) {
+	m := marshalMeta{
+		Announce: "http://tracker/",
+		Info: marshalInfo{
+			Name:        "test",
+			PieceLength: 16384,
+			Pieces:      []byte("aaaaaaaaaaaaaaaaaaaa"),
+			Length:      100,
+		},
+		Skipped:  "x",
+		internal: 1,
+	}
+	got, err := Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := "d8:announce15:http://tracker/4:infod6:lengthi100e4:name4:test12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaaee"
+	if string(got) != want {
+		t.Errorf("Marshal =\n %q\nwant\n %q", got, want)
+	}
+}
+
+func TestMarshalTypes(t *testing.T) {
+	comment := "hi"
+	tests := []struct {
+		name  string
+		input any
+		want  string
+	}{
+		{"int", 42, "i42e"},
+		{"int8", int8(-3), "i-3e"},
+		{"uint16", uint16(6881), "i6881e"},
+		{"bool true", true, "i1e"},
+		{"bool false", false, "i0e"},
+		{"string", "spam", "4:spam"},
+		{"bytes", []byte("eggs"), "4:eggs"},
+		{"byte array", [4]byte{'a', 'b', 'c', 'd'}, "4:abcd"},
+		{"string slice", []string{"a", "bc"}, "l1:a2:bce"},
+		{"int array", [2]int{1, 2}, "li1ei2ee"},
+		{"map", map[string]int{"b": 2, "a": 1}, "d1:ai1e1:bi2ee"},
+		{"value map", map[string]Value{"k": []Value{int64(1)}}, "d1:kli1eee"},
+		{"pointer", &comment, "2:hi"},
+		{"nil field omitted", struct {
+			A *int `bencode:"a"`
+			B int  `bencode:"b"`
+		}{B: 1}, "d1:bi1ee"},
+		{"untagged field", struct{ Name string }{"x"}, "d4:Name1:xe"},
+	}
+	for _, tt := range tests {
+		got, err := Marshal(tt.input)
+		if err != nil {
+			t.Errorf("%s: Marshal: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: Marshal = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMarshalEmbedded(t *testing.T) {
+	type inner struct {
+		B int `bencode:"b"`
+	}
+	type outer struct {
+		inner
+		A int `bencode:"a"`
+	}
+	got, err := Marshal(outer{inner: inner{B: 2}, A: 1})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(got) != "d1:ai1e1:bi2ee" {
+		t.Errorf("Marshal = %q", got)
+	}
+}
+
+func TestEmbeddedConflicts(t *testing.T) {
+	type inner struct {
+		A int `bencode:"a"`
+		B int `bencode:"b"`
+		C int
+	}
+	type other struct {
+		B int `bencode:"b"`
+		C int `bencode:"C"`
+	}
+	type outer struct {
+		inner     // declared first, but its "a" is shadowed by the shallower field
+		other     // "b" is ambiguous with inner's; "C" is tagged here and wins over inner's
+		A     int `bencode:"a"`
+	}
+	v := outer{inner: inner{A: 1, B: 2, C: 3}, other: other{B: 4, C: 5}, A: 6}
+	got, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(got) != "d1:Ci5e1:ai6ee" {
+		t.Errorf("Marshal = %q", got)
+	}
+
+	var back outer
+	if err := Unmarshal([]byte("d1:Ci7e1:ai8e1:bi9ee"), &back); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if back != (outer{other: other{C: 7}, A: 8}) {
+		t.Errorf("Unmarshal = %+v", back)
+	}
+}
+
+type upperString string
+
+func (u upperString) MarshalBencode() ([]byte, error) {
+	return Marshal("UP:" + string(u))
+}
+
+type badMarshaler struct{}
+
+func (badMarshaler) MarshalBencode() ([]byte, error) { return []byte("i1"), nil }
+
+type failingMarshaler struct{}
+
+var errMarshalFailed = errors.New("marshal failed")
+
+func (failingMarshaler) MarshalBencode() ([]byte, error) { return nil, errMarshalFailed }
+
+func TestMarshalMarshaler(t *testing.T) {
+	got, err := Marshal(map[string]upperString{"k": "v"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(got) != "d1:k4:UP:ve" {
+		t.Errorf("Marshal = %q", got)
+	}
+	if _, err := Marshal(badMarshaler{}); err == nil {
+		t.Error("Marshal(badMarshaler) expected error for invalid output")
+	}
+	if _, err := Marshal(failingMarshaler{}); !errors.Is(err, errMarshalFailed) {
+		t.Errorf("Marshal(failingMarshaler) = %v, want errMarshalFailed", err)
+	}
+}
+
+func TestMarshalUnsupported(t *testing.T) {
+	inputs := []any{nil, 1.5, map[int]string{1: "a"}, make(chan int)}
+	for _, in := range inputs {
+		if _, err := Marshal(in); err == nil {
+			t.Errorf("Marshal(%T) expected error, got nil", in)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package bencode
+
+import (
+	"fmt"
+)
+
+// DecoderOptions bounds the work a decoder does on untrusted input such as tracker responses
+// and peer messages. A zero limit means no limit.
+type DecoderOptions struct {
+	MaxDepth       int  // maximum nesting of lists and dictionaries
+	MaxStringLen   int  // maximum length of a single string, checked before it is allocated
+	MaxListLen     int  // maximum number of elements in a list or entries in a dictionary
+	MaxTotalAllocs int  // maximum number of strings, lists and dictionaries in one value
+	Strict         bool // reject non-canonical input, as DecodeStrict does
+
+	// ZeroCopy makes decoded []byte values alias the input instead of copying it, which
+	// avoids doubling memory for large strings such as a torrent's "pieces". The caller must
+	// not modify the input while decoded values are in use. Strings decoded into Go string
+	// fields, and RawMessage values, are still copied.
+	ZeroCopy bool
+}
+
+// LimitError reports input that is well-formed so far but exceeds a DecoderOptions limit.
+// It is distinct from a syntax error: the data may be valid bencode, just too large to accept.
+type LimitError struct {
+	Offset int    // byte offset at which the limit was exceeded
+	Path   string // key path of the enclosing value; empty at the root
+	Limit  string // name of the DecoderOptions field, e.g. "MaxDepth"
+	Max    int    // configured value of that limit
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("bencode: %s of %d exceeded at position %d%s", e.Limit, e.Max, e.Offset, inPath(e.Path))
+}
+
+// DecodeWithOptions is like Decode but enforces opts.
+// With opts.Strict it also rejects data after the root value.
+func DecodeWithOptions(data []byte, opts DecoderOptions) (Value, error) {
+	d := decoder{data: data, opts: opts}
+	v, err := d.decodeRoot()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Strict {
+		if err := d.checkEnd(); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// UnmarshalWithOptions is like Unmarshal but enforces opts.
+// With opts.Strict it also rejects data after the root value.
+func UnmarshalWithOptions(data []byte, v any, opts DecoderOptions) error {
+	d := decoder{data: data, opts: opts}
+	if err := d.unmarshalRoot(v); err != nil {
+		return err
+	}
+	if opts.Strict {
+		return d.checkEnd()
+	}
+	return nil
+}
+
+// SetOptions makes the decoder enforce opts on subsequent tokens and values.
+// MaxTotalAllocs applies to each top-level value separately, so a long-lived stream of
+// messages is not cut off by its cumulative size. With ZeroCopy, values from Decode alias a
+// buffer that holds only that value and is never reused.
+func (d *Decoder) SetOptions(opts DecoderOptions) {
+	d.opts = opts
+}
+
+func checkDepth(opts *DecoderOptions, depth, off int) error {
+	if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+		return &LimitError{Offset: off, Limit: "MaxDepth", Max: opts.MaxDepth}
+	}
+	return nil
+}
+
+func checkStringLen(opts *DecoderOptions, n int64, off int) error {
+	if opts.MaxStringLen > 0 && n > int64(opts.MaxStringLen) {
+		return &LimitError{Offset: off, Limit: "MaxStringLen", Max: opts.MaxStringLen}
+	}
+	return nil
+}
+
+func checkListLen(opts *DecoderOptions, n, off int) error {
+	if opts.MaxListLen > 0 && n > opts.MaxListLen {
+		return &LimitError{Offset: off, Limit: "MaxListLen", Max: opts.MaxListLen}
+	}
+	return nil
+}
+
+func checkAllocs(opts *DecoderOptions, n, off int) error {
+	if opts.MaxTotalAllocs > 0 && n > opts.MaxTotalAllocs {
+		return &LimitError{Offset: off, Limit: "MaxTotalAllocs", Max: opts.MaxTotalAllocs}
+	}
+	return nil
+}
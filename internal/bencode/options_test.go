@@ -0,0 +1,85 @@
+package bencode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeWithOptionsLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  DecoderOptions
+		limit string
+	}{
+		{"depth list", "lllleeee", DecoderOptions{MaxDepth: 3}, "MaxDepth"},
+		{"depth dict", "d1:ad1:ad1:adeeee", DecoderOptions{MaxDepth: 3}, "MaxDepth"},
+		{"string", "5:hello", DecoderOptions{MaxStringLen: 4}, "MaxStringLen"},
+		{"string claim", "99999999999:x", DecoderOptions{MaxStringLen: 1 << 20}, "MaxStringLen"},
+		{"dict key", "d5:helloi1ee", DecoderOptions{MaxStringLen: 4}, "MaxStringLen"},
+		{"list", "li1ei2ei3ee", DecoderOptions{MaxListLen: 2}, "MaxListLen"},
+		{"dict", "d1:ai1e1:bi2e1:ci3ee", DecoderOptions{MaxListLen: 2}, "MaxListLen"},
+		{"allocs", "l1:a1:b1:ce", DecoderOptions{MaxTotalAllocs: 3}, "MaxTotalAllocs"},
+	}
+	for _, tt := range tests {
+		_, err := DecodeWithOptions([]byte(tt.input), tt.opts)
+		var le *LimitError
+		if !errors.As(err, &le) {
+			t.Errorf("%s: DecodeWithOptions = %v, want *LimitError", tt.name, err)
+			continue
+		}
+		if le.Limit != tt.limit {
+			t.Errorf("%s: Limit = %q, want %q", tt.name, le.Limit, tt.limit)
+		}
+
+		var v Value
+		err = UnmarshalWithOptions([]byte(tt.input), &v, tt.opts)
+		if !errors.As(err, &le) || le.Limit != tt.limit {
+			t.Errorf("%s: UnmarshalWithOptions = %v, want %s LimitError", tt.name, err, tt.limit)
+		}
+
+		dec := NewDecoder(strings.NewReader(tt.input))
+		dec.SetOptions(tt.opts)
+		err = dec.Decode(&v)
+		if !errors.As(err, &le) || le.Limit != tt.limit {
+			t.Errorf("%s: Decoder.Decode = %v, want %s LimitError", tt.name, err, tt.limit)
+		}
+	}
+}
+
+func TestDecodeWithOptionsWithinLimits(t *testing.T) {
+	opts := DecoderOptions{MaxDepth: 3, MaxStringLen: 5, MaxListLen: 3, MaxTotalAllocs: 8}
+	input := "d1:ald1:xi1eee1:b5:helloe"
+	if _, err := DecodeWithOptions([]byte(input), opts); err != nil {
+		t.Errorf("DecodeWithOptions: %v", err)
+	}
+	var st struct {
+		A []map[string]int `bencode:"a"`
+		B string           `bencode:"b"`
+	}
+	if err := UnmarshalWithOptions([]byte(input), &st, opts); err != nil {
+		t.Errorf("UnmarshalWithOptions: %v", err)
+	}
+}
+
+func TestLimitErrorIsNotSyntaxError(t *testing.T) {
+	// Syntax errors are not reported as limit errors, even when limits are set.
+	_, err := DecodeWithOptions([]byte("lx"), DecoderOptions{MaxDepth: 10})
+	var le *LimitError
+	if err == nil || errors.As(err, &le) {
+		t.Errorf("DecodeWithOptions(lx) = %v, want a non-limit error", err)
+	}
+}
+
+func TestDecoderAllocsPerValue(t *testing.T) {
+	// MaxTotalAllocs resets between top-level values on a stream.
+	dec := NewDecoder(strings.NewReader("l1:ae" + "l1:ae" + "l1:ae"))
+	dec.SetOptions(DecoderOptions{MaxTotalAllocs: 2})
+	for i := 0; i < 3; i++ {
+		var v Value
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("Decode %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package bencode
+
+import "errors"
+
+// RawMessage is a raw encoded bencode value.
+// As an Unmarshal target it keeps the exact original bytes of a sub-value (for example the
+// "info" dict, whose SHA-1 is the info hash); Marshal writes those bytes back unchanged.
+type RawMessage []byte
+
+// MarshalBencode returns m as the encoding of m.
+func (m RawMessage) MarshalBencode() ([]byte, error) {
+	if len(m) == 0 {
+		return nil, errors.New("bencode: cannot marshal empty RawMessage")
+	}
+	return m, nil
+}
+
+// UnmarshalBencode sets *m to a copy of data.
+func (m *RawMessage) UnmarshalBencode(data []byte) error {
+	*m = append((*m)[:0], data...)
+	return nil
+}
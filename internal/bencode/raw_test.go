@@ -0,0 +1,65 @@
+package bencode
+
+import (
+	"testing"
+)
+
+func TestRawMessageUnmarshal(t *testing.T) {
+	// Non-canonical spacing inside the sub-value must be preserved exactly.
+	input := []byte("d4:infod6:lengthi100e4:name4:teste4:signl3:abci-1eee")
+	var root struct {
+		Info RawMessage `bencode:"info"`
+		Sign RawMessage `bencode:"sign"`
+	}
+	if err := Unmarshal(input, &root); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if string(root.Info) != "d6:lengthi100e4:name4:teste" {
+		t.Errorf("Info = %q", root.Info)
+	}
+	if string(root.Sign) != "l3:abci-1ee" {
+		t.Errorf("Sign = %q", root.Sign)
+	}
+	// The captured bytes must not alias the input.
+	input[8] = 'X'
+	if root.Info[1] == 'X' {
+		t.Error("RawMessage aliases the input buffer")
+	}
+}
+
+func TestRawMessageMarshal(t *testing.T) {
+	// Raw bytes are emitted unchanged, even if they are not canonical.
+	v := struct {
+		Info RawMessage `bencode:"info"`
+		Name string     `bencode:"name"`
+	}{Info: RawMessage("d1:bi1e1:ai2ee"), Name: "x"}
+	got, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(got) != "d4:infod1:bi1e1:ai2ee4:name1:xe" {
+		t.Errorf("Marshal = %q", got)
+	}
+	if _, err := Marshal(RawMessage(nil)); err == nil {
+		t.Error("Marshal(empty RawMessage) expected error")
+	}
+	if _, err := Marshal(RawMessage("i1")); err == nil {
+		t.Error("Marshal(invalid RawMessage) expected error")
+	}
+}
+
+func TestRawMessageInList(t *testing.T) {
+	var items []RawMessage
+	if err := Unmarshal([]byte("li1e3:abcdee"), &items); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := []string{"i1e", "3:abc", "de"}
+	if len(items) != len(want) {
+		t.Fatalf("len = %d, want %d", len(items), len(want))
+	}
+	for i, w := range want {
+		if string(items[i]) != w {
+			t.Errorf("items[%d] = %q, want %q", i, items[i], w)
+		}
+	}
+}
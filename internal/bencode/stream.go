@@ -0,0 +1,351 @@
+package bencode
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+)
+
+// Delim is a list or dictionary delimiter token returned by Decoder.Token.
+type Delim byte
+
+const (
+	ListStart Delim = 'l'
+	DictStart Delim = 'd'
+	End       Delim = 'e'
+)
+
+func (d Delim) String() string {
+	return string(d)
+}
+
+// Token is one element of the bencode token stream: an int64, a []byte string, or a Delim.
+type Token interface{}
+
+const (
+	maxIntDigits    = 20 // "-9223372036854775808"
+	maxLengthDigits = 19 // string length prefix, fits in int64
+	stringChunk     = 64 * 1024
+)
+
+// frame is one open list or dictionary on the decoder stack.
+type frame struct {
+	delim   Delim
+	n       int    // values read so far; in a dictionary, even n means a key is expected next
+	lastKey []byte // previous dictionary key, for canonical ordering checks
+}
+
+// Decoder reads bencoded values from an input stream.
+// Unlike Decode, it does not need the whole input in memory: Token reads one element at a
+// time, and Decode buffers only the single value it is decoding.
+type Decoder struct {
+	r     *bufio.Reader
+	off   int64
+	stack []frame
+
+	raw       []byte // bytes of the value being captured by Decode
+	recording bool
+	opts      DecoderOptions
+	allocs    int // strings, lists and dictionaries in the current top-level value
+}
+
+// NewDecoder returns a decoder that reads from r.
+// The decoder buffers reads, so it may consume more bytes from r than it returns; use
+// InputOffset to find where the last token ended.
+func NewDecoder(r io.Reader) *Decoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Decoder{r: br}
+}
+
+// DisallowNonCanonical makes the decoder reject non-canonical input, as DecodeStrict does:
+// unsorted or duplicate dictionary keys and leading zeros in string lengths.
+func (d *Decoder) DisallowNonCanonical() {
+	d.opts.Strict = true
+}
+
+// InputOffset returns the number of input bytes consumed by the tokens and values read so far.
+func (d *Decoder) InputOffset() int64 {
+	return d.off
+}
+
+// More reports whether there is another element in the current list or dictionary.
+func (d *Decoder) More() bool {
+	c, err := d.peekByte()
+	return err == nil && c != byte(End)
+}
+
+// Token returns the next token in the input stream.
+// Strings are returned as []byte, integers as int64, and the start and end of lists and
+// dictionaries as ListStart, DictStart and End. At the end of the input between top-level
+// values, Token returns nil, io.EOF.
+func (d *Decoder) Token() (Token, error) {
+	tok, err := d.next(true)
+	if err != nil && err != io.EOF {
+		return nil, locate(err, 0, d.path())
+	}
+	return tok, err
+}
+
+// Decode reads the next complete bencoded value and stores it in the value pointed to by v,
+// following the rules of Unmarshal. It can be mixed with Token to decode one element of a
+// larger list or dictionary at a time.
+func (d *Decoder) Decode(v any) error {
+	depth := len(d.stack)
+	base, prefix := d.off, d.path()
+	d.raw = nil
+	d.recording = true
+	defer func() { d.recording = false }()
+
+	tok, err := d.next(false)
+	if err == io.EOF {
+		return err
+	}
+	if err != nil {
+		return locate(err, 0, d.path())
+	}
+	if tok == End {
+		return &SyntaxError{Offset: int(d.off - 1), Path: prefix, Kind: UnexpectedEnd}
+	}
+	for len(d.stack) > depth {
+		if _, err := d.next(false); err != nil {
+			return locate(err, 0, d.path())
+		}
+	}
+	d.recording = false
+	u := decoder{data: d.raw, opts: d.opts}
+	if err := u.unmarshalRoot(v); err != nil {
+		return locate(err, int(base), prefix)
+	}
+	return nil
+}
+
+// next reads one token. When keep is false, string contents are consumed (and recorded)
+// but not returned, so Decode does not hold two copies of large strings.
+func (d *Decoder) next(keep bool) (Token, error) {
+	c, err := d.peekByte()
+	if err == io.EOF && len(d.stack) == 0 {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, d.unexpectedEOF(err)
+	}
+	top := d.top()
+	if top == nil {
+		d.allocs = 0
+	} else if c != byte(End) {
+		if err := d.checkElement(top, c); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case c == byte(End):
+		if top == nil {
+			return nil, &SyntaxError{Offset: int(d.off), Kind: UnexpectedEnd}
+		}
+		if top.delim == DictStart && top.n%2 == 1 {
+			return nil, &SyntaxError{Offset: int(d.off), Kind: MissingValue}
+		}
+		d.readByte()
+		d.stack = d.stack[:len(d.stack)-1]
+		d.finishValue()
+		return End, nil
+	case c == byte(ListStart) || c == byte(DictStart):
+		if err := checkDepth(&d.opts, len(d.stack)+1, int(d.off)); err != nil {
+			return nil, err
+		}
+		if err := d.alloc(); err != nil {
+			return nil, err
+		}
+		d.readByte()
+		d.stack = append(d.stack, frame{delim: Delim(c)})
+		return Delim(c), nil
+	case c == 'i':
+		n, err := d.readInt()
+		if err != nil {
+			return nil, err
+		}
+		d.finishValue()
+		return n, nil
+	case c >= '0' && c <= '9':
+		isKey := top != nil && top.delim == DictStart && top.n%2 == 0
+		start := d.off
+		b, err := d.readString(keep || isKey)
+		if err != nil {
+			return nil, err
+		}
+		if isKey {
+			if err := checkKeyOrder(d.opts.Strict, top.lastKey, b, top.n > 0, int(start)); err != nil {
+				return nil, err
+			}
+			top.lastKey = b
+		}
+		d.finishValue()
+		if !keep {
+			return []byte(nil), nil
+		}
+		return b, nil
+	default:
+		return nil, &SyntaxError{Offset: int(d.off), Kind: InvalidCharacter}
+	}
+}
+
+// checkElement validates the first byte c of a new element inside the open container top.
+func (d *Decoder) checkElement(top *frame, c byte) error {
+	if top.delim == ListStart {
+		return checkListLen(&d.opts, top.n+1, int(d.off))
+	}
+	if top.n%2 == 1 {
+		return nil // dictionary value
+	}
+	if c < '0' || c > '9' {
+		return &SyntaxError{Offset: int(d.off), Kind: NonStringKey}
+	}
+	return checkListLen(&d.opts, top.n/2+1, int(d.off))
+}
+
+// alloc counts one allocated value against MaxTotalAllocs.
+func (d *Decoder) alloc() error {
+	d.allocs++
+	return checkAllocs(&d.opts, d.allocs, int(d.off))
+}
+
+// path returns the key path of the element being read.
+func (d *Decoder) path() string {
+	var elems []pathElem
+	for _, f := range d.stack {
+		switch {
+		case f.delim == ListStart:
+			elems = append(elems, pathElem{index: f.n, isIndex: true})
+		case f.n%2 == 1:
+			elems = append(elems, pathElem{key: f.lastKey})
+		}
+	}
+	return formatPath(elems)
+}
+
+func (d *Decoder) top() *frame {
+	if len(d.stack) == 0 {
+		return nil
+	}
+	return &d.stack[len(d.stack)-1]
+}
+
+// finishValue records that a complete value (or key) was read in the enclosing container.
+func (d *Decoder) finishValue() {
+	if top := d.top(); top != nil {
+		top.n++
+	}
+}
+
+func (d *Decoder) readInt() (int64, error) {
+	start := d.off
+	d.readByte() // consume 'i'
+	var digits []byte
+	for {
+		c, err := d.readByte()
+		if err != nil {
+			return 0, d.unexpectedEOF(err)
+		}
+		if c == 'e' {
+			break
+		}
+		if (c < '0' || c > '9') && !(c == '-' && len(digits) == 0) {
+			return 0, &SyntaxError{Offset: int(d.off - 1), Kind: InvalidInteger}
+		}
+		if len(digits) == maxIntDigits {
+			return 0, &SyntaxError{Offset: int(start) + 1, Kind: InvalidInteger}
+		}
+		digits = append(digits, c)
+	}
+	return parseInt(string(digits), int(start)+1, d.opts.Strict)
+}
+
+func (d *Decoder) readString(keep bool) ([]byte, error) {
+	start := d.off
+	var digits []byte
+	for {
+		c, err := d.readByte()
+		if err != nil {
+			return nil, d.unexpectedEOF(err)
+		}
+		if c == ':' {
+			break
+		}
+		if c < '0' || c > '9' || len(digits) == maxLengthDigits {
+			return nil, &SyntaxError{Offset: int(start), Kind: InvalidStringLength}
+		}
+		digits = append(digits, c)
+	}
+	if err := checkLength(d.opts.Strict, digits, int(start)); err != nil {
+		return nil, err
+	}
+	length, err := strconv.ParseInt(string(digits), 10, 64)
+	if err != nil {
+		return nil, &SyntaxError{Offset: int(start), Kind: InvalidStringLength}
+	}
+	if err := checkStringLen(&d.opts, length, int(start)); err != nil {
+		return nil, err
+	}
+	if err := d.alloc(); err != nil {
+		return nil, err
+	}
+	// Grow the buffer as data arrives rather than trusting the claimed length up front.
+	var buf bytes.Buffer
+	var dst io.Writer = io.Discard
+	if keep {
+		buf.Grow(int(min(length, stringChunk)))
+		dst = &buf
+	}
+	if d.recording {
+		dst = io.MultiWriter(dst, rawWriter{d})
+	}
+	n, err := io.CopyN(dst, d.r, length)
+	d.off += n
+	if err != nil {
+		return nil, d.unexpectedEOF(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// rawWriter appends string contents to the value being captured by Decode.
+type rawWriter struct{ d *Decoder }
+
+func (w rawWriter) Write(p []byte) (int, error) {
+	w.d.raw = append(w.d.raw, p...)
+	return len(p), nil
+}
+
+func (d *Decoder) peekByte() (byte, error) {
+	b, err := d.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *Decoder) readByte() (byte, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	d.off++
+	if d.recording {
+		d.raw = append(d.raw, c)
+	}
+	return c, nil
+}
+
+func (d *Decoder) unexpectedEOF(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == io.ErrUnexpectedEOF {
+		return &SyntaxError{Offset: int(d.off), Kind: UnexpectedEOF}
+	}
+	return err
+}
@@ -0,0 +1,136 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecoderToken(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("d3:cowl3:mooi-7ee4:spamdee"))
+	want := []Token{DictStart, []byte("cow"), ListStart, []byte("moo"), int64(-7), End, []byte("spam"), DictStart, End, End}
+	for i, w := range want {
+		tok, err := dec.Token()
+		if err != nil {
+			t.Fatalf("token %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(tok, w) {
+			t.Fatalf("token %d = %#v, want %#v", i, tok, w)
+		}
+	}
+	if tok, err := dec.Token(); err != io.EOF {
+		t.Errorf("after last token: got %v, %v; want io.EOF", tok, err)
+	}
+	if dec.InputOffset() != 26 {
+		t.Errorf("InputOffset = %d, want 26", dec.InputOffset())
+	}
+}
+
+func TestDecoderTokenInvalid(t *testing.T) {
+	invalid := []string{"x", "i", "i12", "i1x", "i01e", "4:ab", "l", "d", "e", "di1ei2ee", "d1:ae", "5x:abcde"}
+	for _, input := range invalid {
+		dec := NewDecoder(strings.NewReader(input))
+		var err error
+		for err == nil {
+			_, err = dec.Token()
+		}
+		if err == io.EOF && input != "" {
+			t.Errorf("Token stream for %q ended cleanly, want error", input)
+		}
+	}
+}
+
+func TestDecoderDecodeSequence(t *testing.T) {
+	// Several top-level values back to back, as on a connection.
+	dec := NewDecoder(strings.NewReader("i1e4:spamd1:ai2ee"))
+	var n int
+	var s string
+	var m map[string]int
+	if err := dec.Decode(&n); err != nil || n != 1 {
+		t.Fatalf("Decode int = %d, %v", n, err)
+	}
+	if err := dec.Decode(&s); err != nil || s != "spam" {
+		t.Fatalf("Decode string = %q, %v", s, err)
+	}
+	if err := dec.Decode(&m); err != nil || m["a"] != 2 {
+		t.Fatalf("Decode dict = %v, %v", m, err)
+	}
+	var v Value
+	if err := dec.Decode(&v); err != io.EOF {
+		t.Errorf("Decode at end = %v, want io.EOF", err)
+	}
+}
+
+func TestDecoderDecodeElements(t *testing.T) {
+	// Walk a large list one element at a time.
+	dec := NewDecoder(strings.NewReader("d5:peersld2:ip1:a4:porti1eed2:ip1:b4:porti2eeee"))
+	type peer struct {
+		IP   string `bencode:"ip"`
+		Port int    `bencode:"port"`
+	}
+	for _, want := range []Token{DictStart, []byte("peers"), ListStart} {
+		if tok, err := dec.Token(); err != nil || !reflect.DeepEqual(tok, want) {
+			t.Fatalf("Token = %#v, %v; want %#v", tok, err, want)
+		}
+	}
+	var peers []peer
+	for dec.More() {
+		var p peer
+		if err := dec.Decode(&p); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		peers = append(peers, p)
+	}
+	if want := []peer{{"a", 1}, {"b", 2}}; !reflect.DeepEqual(peers, want) {
+		t.Errorf("peers = %+v, want %+v", peers, want)
+	}
+	for _, want := range []Token{End, End} {
+		if tok, err := dec.Token(); err != nil || tok != want {
+			t.Fatalf("Token = %#v, %v; want End", tok, err)
+		}
+	}
+}
+
+func TestDecoderDecodeTruncated(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("d4:name4:te"))
+	var v Value
+	err := dec.Decode(&v)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Decode truncated = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestDecoderHugeLengthClaim(t *testing.T) {
+	// A length prefix far larger than the input must fail without allocating it up front.
+	dec := NewDecoder(strings.NewReader("999999999999:abc"))
+	if _, err := dec.Token(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Token = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestDecoderMatchesDecode(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "game.torrent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Value
+	dec := NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("Decoder.Decode: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("Decoder.Decode differs from Decode")
+	}
+	if dec.InputOffset() != int64(len(data)) {
+		t.Errorf("InputOffset = %d, want %d", dec.InputOffset(), len(data))
+	}
+}
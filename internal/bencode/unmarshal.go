@@ -0,0 +1,249 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Unmarshaler is implemented by types that can decode a bencoded representation of themselves.
+// The input is the complete encoding of one value; implementations must copy it if they keep it.
+type Unmarshaler interface {
+	UnmarshalBencode([]byte) error
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+// UnmarshalTypeError describes a bencode value that cannot be stored in a Go value of a given type.
+type UnmarshalTypeError struct {
+	Value  string       // bencode kind: "integer", "string", "list" or "dictionary"
+	Type   reflect.Type // Go type it could not be assigned to
+	Offset int          // byte offset of the value in the input
+	Path   string       // key path of the value, e.g. "info.piece length"
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return fmt.Sprintf("bencode: cannot unmarshal %s into Go value of type %s at position %d%s", e.Value, e.Type, e.Offset, inPath(e.Path))
+}
+
+// Unmarshal decodes bencoded data into the value pointed to by v.
+//
+// It is the inverse of Marshal: integers decode into int, uint and bool (0 or 1) kinds; strings
+// into string, []byte and [N]byte (lengths must match); lists into slices; dictionaries into
+// structs (matched by tag) and maps with string keys. Dictionary keys without a matching struct
+// field are skipped. Pointers are allocated as needed, and an empty interface receives the same
+// Value that Decode would return.
+func Unmarshal(data []byte, v any) error {
+	d := decoder{data: data}
+	return d.unmarshalRoot(v)
+}
+
+func (d *decoder) unmarshalRoot(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("bencode: Unmarshal requires a non-nil pointer")
+	}
+	if err := d.unmarshal(rv.Elem()); err != nil {
+		return locate(err, 0, formatPath(d.path))
+	}
+	return nil
+}
+
+func (d *decoder) unmarshal(v reflect.Value) error {
+	if d.pos >= len(d.data) {
+		return d.syntaxError(UnexpectedEOF, d.pos)
+	}
+	// Walk through pointers, allocating as needed, stopping at the first Unmarshaler.
+	for {
+		if v.Kind() != reflect.Pointer && v.CanAddr() && v.Addr().Type().Implements(unmarshalerType) {
+			return d.unmarshalWith(v.Addr().Interface().(Unmarshaler))
+		}
+		if v.Kind() != reflect.Pointer {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		val, err := d.decode()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(val))
+		return nil
+	}
+
+	switch d.data[d.pos] {
+	case 'i':
+		return d.unmarshalInt(v)
+	case 'l':
+		return d.unmarshalList(v)
+	case 'd':
+		return d.unmarshalDict(v)
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return d.unmarshalString(v)
+	default:
+		return d.syntaxError(InvalidCharacter, d.pos)
+	}
+}
+
+func (d *decoder) unmarshalWith(u Unmarshaler) error {
+	start := d.pos
+	if _, err := d.decode(); err != nil {
+		return err
+	}
+	if err := u.UnmarshalBencode(d.data[start:d.pos]); err != nil {
+		return locate(err, start, "")
+	}
+	return nil
+}
+
+func (d *decoder) unmarshalInt(v reflect.Value) error {
+	start := d.pos
+	n, err := d.decodeInt()
+	if err != nil {
+		return err
+	}
+	typeErr := &UnmarshalTypeError{Value: "integer", Type: v.Type(), Offset: start}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(n) {
+			return typeErr
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n < 0 || v.OverflowUint(uint64(n)) {
+			return typeErr
+		}
+		v.SetUint(uint64(n))
+	case reflect.Bool:
+		if n != 0 && n != 1 {
+			return typeErr
+		}
+		v.SetBool(n == 1)
+	default:
+		return typeErr
+	}
+	return nil
+}
+
+func (d *decoder) unmarshalString(v reflect.Value) error {
+	start := d.pos
+	b, err := d.decodeString()
+	if err != nil {
+		return err
+	}
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(string(b))
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		v.SetBytes(b)
+		return nil
+	case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 && v.Len() == len(b):
+		reflect.Copy(v, reflect.ValueOf(b))
+		return nil
+	}
+	return &UnmarshalTypeError{Value: "string", Type: v.Type(), Offset: start}
+}
+
+func (d *decoder) unmarshalList(v reflect.Value) error {
+	start := d.pos
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return &UnmarshalTypeError{Value: "list", Type: v.Type(), Offset: start}
+	}
+	if err := d.open(); err != nil {
+		return err
+	}
+	d.pos++ // consume 'l'
+	list := reflect.MakeSlice(v.Type(), 0, 0)
+	for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+		if err := checkListLen(&d.opts, list.Len()+1, d.pos); err != nil {
+			return err
+		}
+		list = reflect.Append(list, reflect.Zero(v.Type().Elem()))
+		d.push(pathElem{index: list.Len() - 1, isIndex: true})
+		if err := d.unmarshal(list.Index(list.Len() - 1)); err != nil {
+			return err
+		}
+		d.pop()
+	}
+	d.depth--
+	if d.pos >= len(d.data) {
+		return d.syntaxError(UnexpectedEOF, d.pos)
+	}
+	d.pos++ // consume 'e'
+	v.Set(list)
+	return nil
+}
+
+func (d *decoder) unmarshalDict(v reflect.Value) error {
+	start := d.pos
+	var fields []field
+	switch {
+	case v.Kind() == reflect.Struct:
+		fields = cachedFields(v.Type())
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+	default:
+		return &UnmarshalTypeError{Value: "dictionary", Type: v.Type(), Offset: start}
+	}
+	if err := d.open(); err != nil {
+		return err
+	}
+	d.pos++ // consume 'd'
+	var prev []byte
+	for n := 1; d.pos < len(d.data) && d.data[d.pos] != 'e'; n++ {
+		keyStart := d.pos
+		if err := checkListLen(&d.opts, n, keyStart); err != nil {
+			return err
+		}
+		if err := d.checkKey(); err != nil {
+			return err
+		}
+		key, err := d.decodeString()
+		if err != nil {
+			return err
+		}
+		if err := checkKeyOrder(d.opts.Strict, prev, key, n > 1, keyStart); err != nil {
+			return err
+		}
+		prev = key
+		d.push(pathElem{key: key})
+		if err := d.checkValue(); err != nil {
+			return err
+		}
+		if err := d.unmarshalEntry(v, fields, key); err != nil {
+			return err
+		}
+		d.pop()
+	}
+	d.depth--
+	if d.pos >= len(d.data) {
+		return d.syntaxError(UnexpectedEOF, d.pos)
+	}
+	d.pos++ // consume 'e'
+	return nil
+}
+
+// unmarshalEntry decodes the value for key into the map or struct v.
+func (d *decoder) unmarshalEntry(v reflect.Value, fields []field, key []byte) error {
+	if v.Kind() == reflect.Map {
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := d.unmarshal(elem); err != nil {
+			return err
+		}
+		v.SetMapIndex(reflect.ValueOf(string(key)).Convert(v.Type().Key()), elem)
+		return nil
+	}
+	f := fieldByName(fields, string(key))
+	if f == nil {
+		_, err := d.decode()
+		return err
+	}
+	return d.unmarshal(v.FieldByIndex(f.index))
+}
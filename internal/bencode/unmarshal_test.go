@@ -0,0 +1,195 @@
+package bencode
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalStruct(t *testing.T) {
+	input := "d8:announce15:http://tracker/7:comment2:hi4:infod5:filesld6:lengthi3e4:pathl1:a1:beee" +
+		"4:name4:test12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaa7:privatei1e5:extrai9ee7:unknownlee"
+	var m marshalMeta
+	if err := Unmarshal([]byte(input), &m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if m.Announce != "http://tracker/" {
+		t.Errorf("Announce = %q", m.Announce)
+	}
+	if m.Comment == nil || *m.Comment != "hi" {
+		t.Errorf("Comment = %v, want pointer to hi", m.Comment)
+	}
+	want := marshalInfo{
+		Name:        "test",
+		PieceLength: 16384,
+		Pieces:      []byte("aaaaaaaaaaaaaaaaaaaa"),
+		Files:       []marshalFile{{Path: []string{"a", "b"}, Length: 3}},
+		Private:     true,
+	}
+	if !reflect.DeepEqual(m.Info, want) {
+		t.Errorf("Info = %+v, want %+v", m.Info, want)
+	}
+}
+
+func TestUnmarshalTypes(t *testing.T) {
+	var (
+		i   int
+		u8  uint8
+		b   bool
+		s   string
+		bs  []byte
+		arr [4]byte
+		ss  []string
+		m   map[string]int
+		v   any
+		p   *int64
+	)
+	tests := []struct {
+		input string
+		dst   any
+		want  any
+	}{
+		{"i-7e", &i, -7},
+		{"i255e", &u8, uint8(255)},
+		{"i1e", &b, true},
+		{"4:spam", &s, "spam"},
+		{"4:eggs", &bs, []byte("eggs")},
+		{"4:abcd", &arr, [4]byte{'a', 'b', 'c', 'd'}},
+		{"l1:a2:bce", &ss, []string{"a", "bc"}},
+		{"d1:ai1e1:bi2ee", &m, map[string]int{"a": 1, "b": 2}},
+		{"li1e1:xe", &v, []Value{int64(1), []byte("x")}},
+	}
+	for _, tt := range tests {
+		if err := Unmarshal([]byte(tt.input), tt.dst); err != nil {
+			t.Errorf("Unmarshal(%q): %v", tt.input, err)
+			continue
+		}
+		got := reflect.ValueOf(tt.dst).Elem().Interface()
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Unmarshal(%q) = %#v, want %#v", tt.input, got, tt.want)
+		}
+	}
+
+	if err := Unmarshal([]byte("i42e"), &p); err != nil {
+		t.Fatalf("Unmarshal into pointer: %v", err)
+	}
+	if p == nil || *p != 42 {
+		t.Errorf("pointer = %v, want 42", p)
+	}
+}
+
+func TestUnmarshalTypeErrors(t *testing.T) {
+	var (
+		u8  uint8
+		s   string
+		arr [20]byte
+		b   bool
+		n   int
+		ss  []string
+	)
+	tests := []struct {
+		input string
+		dst   any
+		kind  string
+	}{
+		{"i256e", &u8, "integer"},
+		{"i-1e", &u8, "integer"},
+		{"i2e", &b, "integer"},
+		{"i1e", &s, "integer"},
+		{"3:abc", &arr, "string"},
+		{"le", &n, "list"},
+		{"de", &ss, "dictionary"},
+	}
+	for _, tt := range tests {
+		err := Unmarshal([]byte(tt.input), tt.dst)
+		var typeErr *UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			t.Errorf("Unmarshal(%q) = %v, want *UnmarshalTypeError", tt.input, err)
+			continue
+		}
+		if typeErr.Value != tt.kind {
+			t.Errorf("Unmarshal(%q) Value = %q, want %q", tt.input, typeErr.Value, tt.kind)
+		}
+	}
+
+	// Offsets point at the offending value, not the enclosing container.
+	var st struct {
+		A int `bencode:"a"`
+	}
+	err := Unmarshal([]byte("d1:a1:xe"), &st)
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Offset != 4 {
+		t.Errorf("Unmarshal field type error = %v, want offset 4", err)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	var v any
+	for _, input := range []string{"", "x", "i", "4:ab", "l", "d", "d1:ae"} {
+		if err := Unmarshal([]byte(input), &v); err == nil {
+			t.Errorf("Unmarshal(%q) expected error, got nil", input)
+		}
+	}
+	if err := Unmarshal([]byte("i1e"), v); err == nil {
+		t.Error("Unmarshal into non-pointer expected error")
+	}
+	var st struct{}
+	if err := Unmarshal([]byte("d1:ai1"), &st); err == nil {
+		t.Error("Unmarshal of truncated skipped value expected error")
+	}
+}
+
+type csvList []string
+
+func (c *csvList) UnmarshalBencode(data []byte) error {
+	var s string
+	if err := Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*c = strings.Split(s, ",")
+	return nil
+}
+
+func (c csvList) MarshalBencode() ([]byte, error) {
+	return Marshal(strings.Join(c, ","))
+}
+
+func TestUnmarshalUnmarshaler(t *testing.T) {
+	var st struct {
+		Tags csvList `bencode:"tags"`
+		N    int     `bencode:"n"`
+	}
+	if err := Unmarshal([]byte("d1:ni3e4:tags5:a,b,ce"), &st); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(st.Tags, csvList{"a", "b", "c"}) || st.N != 3 {
+		t.Errorf("got %+v", st)
+	}
+}
+
+func TestMarshalUnmarshalRoundTrip(t *testing.T) {
+	in := marshalMeta{
+		Announce: "http://tracker/",
+		Info: marshalInfo{
+			Name:        "dir",
+			PieceLength: 32768,
+			Pieces:      []byte("0123456789abcdefghij"),
+			Files: []marshalFile{
+				{Path: []string{"a.txt"}, Length: 1},
+				{Path: []string{"sub", "b.txt"}, Length: 2},
+			},
+		},
+	}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var out marshalMeta
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip = %+v, want %+v", out, in)
+	}
+}
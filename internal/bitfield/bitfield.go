@@ -0,0 +1,206 @@
+// Package bitfield implements the set of pieces a peer has, in the bit order of the
+// peer wire bitfield message: piece 0 is the high bit of the first byte.
+package bitfield
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+var (
+	ErrLength    = errors.New("bitfield has the wrong length")
+	ErrSpareBits = errors.New("bitfield has spare bits set")
+)
+
+// Bitfield is a fixed-size set of piece indexes. The zero value is an empty bitfield of
+// length 0; use New to size it to a torrent's piece count.
+type Bitfield struct {
+	words []uint64 // bit i is bit 63-i%64 of words[i/64], so the words are the wire bytes in big-endian order
+	n     int
+}
+
+// New returns an empty bitfield for n pieces.
+func New(n int) *Bitfield {
+	if n < 0 {
+		panic("bitfield: negative length")
+	}
+	return &Bitfield{words: make([]uint64, (n+63)/64), n: n}
+}
+
+// FromBytes decodes the payload of a bitfield message for a torrent of n pieces. The
+// payload must have exactly (n+7)/8 bytes, and the spare bits after the last piece must
+// be zero.
+func FromBytes(b []byte, n int) (*Bitfield, error) {
+	if n < 0 || len(b) != (n+7)/8 {
+		return nil, fmt.Errorf("%w: %d bytes for %d pieces", ErrLength, len(b), n)
+	}
+	bf := New(n)
+	for i := range bf.words {
+		var word [8]byte
+		copy(word[:], b[i*8:])
+		bf.words[i] = binary.BigEndian.Uint64(word[:])
+	}
+	if len(bf.words) > 0 && bf.words[len(bf.words)-1]&^bf.lastMask() != 0 {
+		return nil, ErrSpareBits
+	}
+	return bf, nil
+}
+
+// Bytes returns the payload of a bitfield message.
+func (b *Bitfield) Bytes() []byte {
+	out := make([]byte, len(b.words)*8)
+	for i, w := range b.words {
+		binary.BigEndian.PutUint64(out[i*8:], w)
+	}
+	return out[:(b.n+7)/8]
+}
+
+// lastMask returns the bits of the last word that hold pieces.
+func (b *Bitfield) lastMask() uint64 {
+	if r := b.n % 64; r != 0 {
+		return ^uint64(0) << (64 - r)
+	}
+	return ^uint64(0)
+}
+
+// Len returns the number of pieces the bitfield covers.
+func (b *Bitfield) Len() int {
+	return b.n
+}
+
+func (b *Bitfield) check(i int) {
+	if i < 0 || i >= b.n {
+		panic(fmt.Sprintf("bitfield: index %d out of range [0, %d)", i, b.n))
+	}
+}
+
+// Set adds piece i. It panics if i is out of range.
+func (b *Bitfield) Set(i int) {
+	b.check(i)
+	b.words[i/64] |= 1 << (63 - i%64)
+}
+
+// Clear removes piece i. It panics if i is out of range.
+func (b *Bitfield) Clear(i int) {
+	b.check(i)
+	b.words[i/64] &^= 1 << (63 - i%64)
+}
+
+// Has reports whether piece i is set. An out-of-range index is never set.
+func (b *Bitfield) Has(i int) bool {
+	return i >= 0 && i < b.n && b.words[i/64]&(1<<(63-i%64)) != 0
+}
+
+// Count returns the number of pieces set.
+func (b *Bitfield) Count() int {
+	n := 0
+	for _, w := range b.words {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// Full reports whether every piece is set.
+func (b *Bitfield) Full() bool {
+	return b.Count() == b.n
+}
+
+// SetAll sets every piece, as for a seeder.
+func (b *Bitfield) SetAll() {
+	for i := range b.words {
+		b.words[i] = ^uint64(0)
+	}
+	if len(b.words) > 0 {
+		b.words[len(b.words)-1] = b.lastMask()
+	}
+}
+
+// Clone returns a copy of b.
+func (b *Bitfield) Clone() *Bitfield {
+	return &Bitfield{words: append([]uint64(nil), b.words...), n: b.n}
+}
+
+// Equal reports whether b and o have the same length and pieces.
+func (b *Bitfield) Equal(o *Bitfield) bool {
+	if b.n != o.n {
+		return false
+	}
+	for i, w := range b.words {
+		if w != o.words[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Bitfield) combine(o *Bitfield, op func(x, y uint64) uint64) *Bitfield {
+	if b.n != o.n {
+		panic(fmt.Sprintf("bitfield: combining lengths %d and %d", b.n, o.n))
+	}
+	out := &Bitfield{words: make([]uint64, len(b.words)), n: b.n}
+	for i, w := range b.words {
+		out.words[i] = op(w, o.words[i])
+	}
+	return out
+}
+
+// Union returns the pieces in b or o. The bitfields must have the same length.
+func (b *Bitfield) Union(o *Bitfield) *Bitfield {
+	return b.combine(o, func(x, y uint64) uint64 { return x | y })
+}
+
+// Intersection returns the pieces in both b and o. The bitfields must have the same length.
+func (b *Bitfield) Intersection(o *Bitfield) *Bitfield {
+	return b.combine(o, func(x, y uint64) uint64 { return x & y })
+}
+
+// Difference returns the pieces in b but not in o; peer.Difference(ours) is what a peer
+// can give us. The bitfields must have the same length.
+func (b *Bitfield) Difference(o *Bitfield) *Bitfield {
+	return b.combine(o, func(x, y uint64) uint64 { return x &^ y })
+}
+
+// NextSet returns the first set piece at or after i, or -1 if there is none.
+func (b *Bitfield) NextSet(i int) int {
+	return b.next(max(i, 0), 0)
+}
+
+// NextClear returns the first unset piece at or after i, or -1 if there is none.
+func (b *Bitfield) NextClear(i int) int {
+	return b.next(max(i, 0), ^uint64(0))
+}
+
+// next finds the first bit at or after i that differs from the matching bit of flip.
+func (b *Bitfield) next(i int, flip uint64) int {
+	if i >= b.n {
+		return -1
+	}
+	wi := i / 64
+	w := (b.words[wi] ^ flip) & (^uint64(0) >> (i % 64))
+	for {
+		if w != 0 {
+			if j := wi*64 + bits.LeadingZeros64(w); j < b.n {
+				return j
+			}
+			return -1
+		}
+		if wi++; wi == len(b.words) {
+			return -1
+		}
+		w = b.words[wi] ^ flip
+	}
+}
+
+// String returns the pieces as a string of '1' and '0'.
+func (b *Bitfield) String() string {
+	s := make([]byte, b.n)
+	for i := range s {
+		s[i] = '0'
+		if b.Has(i) {
+			s[i] = '1'
+		}
+	}
+	return string(s)
+}
@@ -0,0 +1,258 @@
+package bitfield
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestSetHasClear(t *testing.T) {
+	b := New(70)
+	if b.Len() != 70 || b.Count() != 0 || b.Full() {
+		t.Fatalf("New(70): len %d, count %d", b.Len(), b.Count())
+	}
+	for _, i := range []int{0, 7, 8, 63, 64, 69} {
+		b.Set(i)
+	}
+	for i := 0; i < 70; i++ {
+		want := i == 0 || i == 7 || i == 8 || i == 63 || i == 64 || i == 69
+		if b.Has(i) != want {
+			t.Errorf("Has(%d) = %v", i, !want)
+		}
+	}
+	if b.Has(-1) || b.Has(70) {
+		t.Error("Has out of range")
+	}
+	if b.Count() != 6 {
+		t.Errorf("Count = %d", b.Count())
+	}
+	b.Clear(7)
+	b.Clear(6) // already clear
+	if b.Has(7) || b.Count() != 5 {
+		t.Errorf("after Clear: Has(7) = %v, Count = %d", b.Has(7), b.Count())
+	}
+	want := "1000000010000000000000000000000000000000000000000000000000000001100001"
+	if b.String() != want {
+		t.Errorf("String = %s", b.String())
+	}
+
+	b.SetAll()
+	if !b.Full() || b.Count() != 70 {
+		t.Errorf("SetAll: count %d", b.Count())
+	}
+	if got := b.Bytes(); !bytes.Equal(got, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfc}) {
+		t.Errorf("Bytes after SetAll = %x", got)
+	}
+}
+
+func TestSetOutOfRange(t *testing.T) {
+	for _, i := range []int{-1, 10} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Set(%d) did not panic", i)
+				}
+			}()
+			New(10).Set(i)
+		}()
+	}
+}
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		n     int
+		set   []int
+		bytes []byte
+	}{
+		{0, nil, []byte{}},
+		{1, []int{0}, []byte{0x80}},
+		{8, []int{0, 7}, []byte{0x81}},
+		{9, []int{8}, []byte{0x00, 0x80}},
+		{20, []int{1, 10, 19}, []byte{0x40, 0x20, 0x10}},
+		{65, []int{64}, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0x80}},
+	}
+	for _, tt := range tests {
+		b := New(tt.n)
+		for _, i := range tt.set {
+			b.Set(i)
+		}
+		if got := b.Bytes(); !bytes.Equal(got, tt.bytes) {
+			t.Errorf("n=%d: Bytes = %x, want %x", tt.n, got, tt.bytes)
+		}
+		back, err := FromBytes(tt.bytes, tt.n)
+		if err != nil {
+			t.Fatalf("n=%d: FromBytes: %v", tt.n, err)
+		}
+		if !back.Equal(b) {
+			t.Errorf("n=%d: FromBytes = %s, want %s", tt.n, back, b)
+		}
+	}
+}
+
+func TestFromBytes_Invalid(t *testing.T) {
+	tests := []struct {
+		b    []byte
+		n    int
+		want error
+	}{
+		{[]byte{0xff}, 9, ErrLength},
+		{[]byte{0xff, 0x80}, 8, ErrLength},
+		{nil, 1, ErrLength},
+		{[]byte{0x01}, 7, ErrSpareBits},
+		{[]byte{0xff, 0x40}, 9, ErrSpareBits},
+		{[]byte{0, 0, 0, 0, 0, 0, 0, 0, 0x7f}, 65, ErrSpareBits},
+	}
+	for _, tt := range tests {
+		if _, err := FromBytes(tt.b, tt.n); !errors.Is(err, tt.want) {
+			t.Errorf("FromBytes(%x, %d) = %v, want %v", tt.b, tt.n, err, tt.want)
+		}
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	ours, theirs := New(10), New(10)
+	for _, i := range []int{0, 1, 2, 5} {
+		ours.Set(i)
+	}
+	for _, i := range []int{1, 5, 8, 9} {
+		theirs.Set(i)
+	}
+	if got := ours.Union(theirs).String(); got != "1110010011" {
+		t.Errorf("Union = %s", got)
+	}
+	if got := ours.Intersection(theirs).String(); got != "0100010000" {
+		t.Errorf("Intersection = %s", got)
+	}
+	if got := theirs.Difference(ours).String(); got != "0000000011" {
+		t.Errorf("Difference = %s", got)
+	}
+	// The operands are unchanged.
+	if ours.String() != "1110010000" || theirs.String() != "0100010011" {
+		t.Errorf("operands changed: %s %s", ours, theirs)
+	}
+	c := ours.Clone()
+	c.Set(9)
+	if ours.Has(9) || ours.Equal(c) {
+		t.Error("Clone shares storage")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Union of different lengths did not panic")
+		}
+	}()
+	ours.Union(New(11))
+}
+
+func TestNextSetNextClear(t *testing.T) {
+	// Compare against a naive scan on random bitfields of awkward lengths.
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 63, 64, 65, 130, 1000} {
+		for _, density := range []float64{0, 0.05, 0.5, 0.95, 1} {
+			b := New(n)
+			for i := 0; i < n; i++ {
+				if rng.Float64() < density {
+					b.Set(i)
+				}
+			}
+			for i := -1; i <= n+1; i++ {
+				wantSet, wantClear := -1, -1
+				for j := max(i, 0); j < n; j++ {
+					if b.Has(j) && wantSet < 0 {
+						wantSet = j
+					}
+					if !b.Has(j) && wantClear < 0 {
+						wantClear = j
+					}
+				}
+				if got := b.NextSet(i); got != wantSet {
+					t.Fatalf("n=%d: NextSet(%d) = %d, want %d", n, i, got, wantSet)
+				}
+				if got := b.NextClear(i); got != wantClear {
+					t.Fatalf("n=%d: NextClear(%d) = %d, want %d", n, i, got, wantClear)
+				}
+			}
+		}
+	}
+}
+
+// benchmarkPair returns two half-full bitfields of n pieces.
+func benchmarkPair(n int) (*Bitfield, *Bitfield) {
+	rng := rand.New(rand.NewSource(1))
+	a, b := New(n), New(n)
+	for i := 0; i < n; i++ {
+		if rng.Intn(2) == 0 {
+			a.Set(i)
+		}
+		if rng.Intn(2) == 0 {
+			b.Set(i)
+		}
+	}
+	return a, b
+}
+
+var benchmarkSizes = []struct {
+	name string
+	n    int
+}{
+	{"1k", 1 << 10},
+	{"64k", 1 << 16},
+	{"1M", 1 << 20},
+}
+
+func BenchmarkCount(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		bf, _ := benchmarkPair(size.n)
+		b.Run(size.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bf.Count()
+			}
+		})
+	}
+}
+
+func BenchmarkDifference(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		theirs, ours := benchmarkPair(size.n)
+		b.Run(size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				theirs.Difference(ours)
+			}
+		})
+	}
+}
+
+func BenchmarkNextClear(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		// A nearly complete download: few pieces left to find.
+		bf := New(size.n)
+		bf.SetAll()
+		for i := 0; i < size.n; i += 1000 {
+			bf.Clear(i)
+		}
+		b.Run(size.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for j := bf.NextClear(0); j >= 0; j = bf.NextClear(j + 1) {
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFromBytes(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		bf, _ := benchmarkPair(size.n)
+		wire := bf.Bytes()
+		b.Run(size.name, func(b *testing.B) {
+			b.SetBytes(int64(len(wire)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := FromBytes(wire, size.n); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
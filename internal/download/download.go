@@ -0,0 +1,333 @@
+// Package download downloads a single-file torrent from its peers: it requests the missing
+// pieces in 16 KiB blocks, verifies each piece against its SHA-1 hash and writes the
+// verified pieces to disk.
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/harioms1522/BitSwift/internal/peer"
+	"github.com/harioms1522/BitSwift/internal/torrent"
+)
+
+const (
+	BlockSize           = 16 * 1024 // bytes per request
+	DefaultMaxPeers     = 20
+	DefaultBlockTimeout = 30 * time.Second
+	DefaultIdleTimeout  = time.Minute
+	maxBacklog          = 5 // requests in flight per peer
+)
+
+var (
+	ErrUnsupported    = errors.New("download: only single-file v1 torrents are supported")
+	ErrPeersExhausted = errors.New("download: no peers left to download from")
+	ErrBadPiece       = errors.New("download: piece failed verification")
+	ErrStalled        = errors.New("download: peer stopped sending requested blocks")
+	ErrIdle           = errors.New("download: peer kept us choked or had no piece we need")
+)
+
+// Config configures a download. Zero values select the defaults.
+type Config struct {
+	PeerID           [20]byte
+	Dialer           peer.Dialer   // nil means a net.Dialer
+	MaxPeers         int           // peers connected at once
+	HandshakeTimeout time.Duration // 0 means peer.DefaultHandshakeTimeout
+	BlockTimeout     time.Duration // drop a peer that sends none of our requested blocks for this long
+	IdleTimeout      time.Duration // drop a peer that chokes us or has no piece we need for this long
+
+	// Progress, if set, is called from the peer goroutines after each verified piece.
+	Progress func(verified, total int)
+}
+
+// downloader is the state shared by the peers of one download.
+type downloader struct {
+	meta    *torrent.Meta
+	layout  *torrent.Layout
+	storage *storage
+	picker  *picker
+	cfg     Config
+}
+
+// Download downloads the single-file torrent meta into dir/<name> and returns the file's
+// path. peers are "ip:port" addresses, tried in order, at most MaxPeers at a time; a peer
+// that disconnects, stalls, sends a corrupt piece, or keeps us choked or without a piece
+// to request is dropped, freeing its slot and handing its piece to another. Download
+// returns when every piece is verified and written, when writing fails, when ctx is done,
+// or when no peer is left.
+func Download(ctx context.Context, meta *torrent.Meta, peers []string, dir string, cfg Config) (string, error) {
+	if len(meta.Info.Files) > 0 || !meta.IsV1() {
+		return "", ErrUnsupported
+	}
+	rel, err := meta.SafeRelativePath(torrent.File{})
+	if err != nil {
+		return "", fmt.Errorf("download: %w", err)
+	}
+	layout, err := meta.Layout()
+	if err != nil {
+		return "", err
+	}
+	if layout.PieceCount != meta.PieceCount() {
+		return "", fmt.Errorf("download: %d piece hashes for %d pieces", meta.PieceCount(), layout.PieceCount)
+	}
+	if cfg.MaxPeers <= 0 {
+		cfg.MaxPeers = DefaultMaxPeers
+	}
+	if cfg.HandshakeTimeout <= 0 {
+		cfg.HandshakeTimeout = peer.DefaultHandshakeTimeout
+	}
+	if cfg.BlockTimeout <= 0 {
+		cfg.BlockTimeout = DefaultBlockTimeout
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("download: %w", err)
+	}
+	path := filepath.Join(dir, rel)
+	st, err := createStorage(path, layout, meta.Info.Pieces)
+	if err != nil {
+		return "", fmt.Errorf("download: %w", err)
+	}
+	d := &downloader{meta: meta, layout: layout, storage: st, picker: newPicker(layout.PieceCount), cfg: cfg}
+	err = d.run(ctx, peers)
+	if cerr := st.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("download: %w", cerr)
+	}
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// run connects to peers until the download finishes or fails.
+func (d *downloader) run(parent context.Context, peers []string) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		lastErr error
+	)
+	exhausted := make(chan struct{}) // closed when every peer has finished
+	go func() {
+		defer close(exhausted)
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		sem := make(chan struct{}, d.cfg.MaxPeers)
+		for _, addr := range peers {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			wg.Add(1)
+			go func(addr string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if err := d.runPeer(ctx, addr); err != nil {
+					mu.Lock()
+					lastErr = fmt.Errorf("%s: %w", addr, err)
+					mu.Unlock()
+				}
+			}(addr)
+		}
+	}()
+
+	select {
+	case <-d.picker.Done():
+	case <-exhausted:
+	case <-ctx.Done():
+	}
+	cancel()
+	<-exhausted
+	select {
+	case <-d.picker.Done():
+		return d.picker.Err()
+	default:
+	}
+	if err := parent.Err(); err != nil {
+		return err
+	}
+	if lastErr != nil {
+		return fmt.Errorf("%w (last error: %w)", ErrPeersExhausted, lastErr)
+	}
+	return ErrPeersExhausted
+}
+
+// runPeer downloads pieces from one peer, one piece at a time, until the download
+// finishes or the peer fails. It returns nil once the download has finished.
+func (d *downloader) runPeer(ctx context.Context, addr string) error {
+	our := &peer.Handshake{InfoHash: d.meta.InfoHash, PeerID: d.cfg.PeerID}
+	hctx, cancel := context.WithTimeout(ctx, d.cfg.HandshakeTimeout)
+	nc, their, err := peer.DialContext(hctx, d.cfg.Dialer, addr, our, our.InfoHash)
+	cancel()
+	if err != nil {
+		return err
+	}
+	c := peer.NewConn(ctx, nc, their, peer.ConnConfig{PieceCount: d.layout.PieceCount})
+	defer c.Close()
+	if err := c.Interested(); err != nil {
+		return err
+	}
+
+	var cur *pieceWork
+	defer func() {
+		if cur != nil {
+			d.picker.release(cur.index)
+		}
+	}()
+	// While a piece is assigned, the timer bounds the wait for its next block; otherwise
+	// it bounds how long the peer may stay useless to us, so it gives up its slot.
+	timer := time.NewTimer(d.cfg.IdleTimeout)
+	defer timer.Stop()
+	for {
+		wake := d.picker.changed()
+		unchoked := !c.State().PeerChoking
+		if cur == nil && unchoked {
+			if i := d.picker.pick(c.Bitfield()); i >= 0 {
+				cur = newPieceWork(i, d.layout.PieceSize(i))
+				resetTimer(timer, d.cfg.BlockTimeout)
+			}
+		}
+		if cur != nil && unchoked {
+			if err := cur.fill(c); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case m, ok := <-c.Messages():
+			if !ok {
+				return c.Err()
+			}
+			switch m.ID {
+			case peer.MsgChoke:
+				// The peer discarded our requests: let another peer have the piece.
+				if cur != nil {
+					d.picker.release(cur.index)
+					cur = nil
+					resetTimer(timer, d.cfg.IdleTimeout)
+				}
+			case peer.MsgPiece:
+				if cur == nil || !cur.receive(m) {
+					continue // not a block we are waiting for
+				}
+				resetTimer(timer, d.cfg.BlockTimeout)
+				if cur.complete() {
+					w := cur
+					cur = nil
+					resetTimer(timer, d.cfg.IdleTimeout)
+					if err := d.finishPiece(w); err != nil {
+						return err
+					}
+				}
+			}
+		case <-wake:
+		case <-timer.C:
+			if cur != nil {
+				return ErrStalled
+			}
+			return ErrIdle
+		case <-d.picker.Done():
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// finishPiece verifies a downloaded piece and writes it. A corrupt piece is handed back
+// to the picker; a write error ends the download.
+func (d *downloader) finishPiece(w *pieceWork) error {
+	if !d.storage.verify(w.index, w.buf) {
+		d.picker.release(w.index)
+		return fmt.Errorf("%w: piece %d", ErrBadPiece, w.index)
+	}
+	if err := d.storage.writePiece(w.index, w.buf); err != nil {
+		err = fmt.Errorf("download: %w", err)
+		d.picker.release(w.index)
+		d.picker.fail(err)
+		return err
+	}
+	n := d.picker.complete(w.index)
+	if d.cfg.Progress != nil {
+		d.cfg.Progress(n, d.layout.PieceCount)
+	}
+	return nil
+}
+
+// resetTimer restarts t, which only the calling goroutine receives from.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// pieceWork is a piece being downloaded from one peer.
+type pieceWork struct {
+	index    int
+	buf      []byte
+	got      []bool // blocks received
+	next     int    // next block to request
+	pending  int    // blocks requested and not yet received
+	received int
+}
+
+func newPieceWork(index int, size int64) *pieceWork {
+	return &pieceWork{
+		index: index,
+		buf:   make([]byte, size),
+		got:   make([]bool, (size+BlockSize-1)/BlockSize),
+	}
+}
+
+// blockLen returns the length of block b; the last block of a piece may be shorter.
+func (w *pieceWork) blockLen(b int) int {
+	return min(BlockSize, len(w.buf)-b*BlockSize)
+}
+
+// fill requests blocks until maxBacklog are in flight or all are requested.
+func (w *pieceWork) fill(c *peer.Conn) error {
+	for w.pending < maxBacklog && w.next < len(w.got) {
+		r := peer.Request{Index: uint32(w.index), Begin: uint32(w.next * BlockSize), Length: uint32(w.blockLen(w.next))}
+		if err := c.Request(r); err != nil {
+			return err
+		}
+		w.next++
+		w.pending++
+	}
+	return nil
+}
+
+// receive stores a piece message if it is a block we requested and have not received.
+func (w *pieceWork) receive(m *peer.Message) bool {
+	if int(m.Index) != w.index || m.Begin%BlockSize != 0 {
+		return false
+	}
+	b := int(m.Begin / BlockSize)
+	if b >= w.next || w.got[b] || len(m.Payload) != w.blockLen(b) {
+		return false
+	}
+	copy(w.buf[m.Begin:], m.Payload)
+	w.got[b] = true
+	w.pending--
+	w.received++
+	return true
+}
+
+// complete reports whether every block has been received.
+func (w *pieceWork) complete() bool {
+	return w.received == len(w.got)
+}
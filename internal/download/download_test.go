@@ -0,0 +1,219 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/harioms1522/BitSwift/internal/bitfield"
+	"github.com/harioms1522/BitSwift/internal/peer"
+	"github.com/harioms1522/BitSwift/internal/torrent"
+)
+
+const testPieceLength = 32 * 1024
+
+// testTorrent builds a single-file torrent of size random bytes and returns it with the content.
+func testTorrent(t *testing.T, size int) (*torrent.Meta, []byte) {
+	t.Helper()
+	content := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(content)
+	src := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(src, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := (&torrent.Builder{PieceLength: testPieceLength}).Build(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := torrent.ParseFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return meta, content
+}
+
+// seeder is an in-process peer that serves a torrent's content.
+type seeder struct {
+	content    []byte
+	infoHash   [20]byte
+	pieces     func(i int) bool // pieces it has; nil means all
+	corrupt    bool             // send every block with its first byte flipped
+	silent     bool             // never answer requests
+	choking    bool             // never unchoke
+	chokeAfter int32            // choke and unchoke again after answering this many requests
+	served     atomic.Int32
+}
+
+func (s *seeder) serve(conn net.Conn) {
+	defer conn.Close()
+	if _, err := io.ReadFull(conn, make([]byte, peer.HandshakeLen)); err != nil {
+		return
+	}
+	conn.Write((&peer.Handshake{InfoHash: s.infoHash, PeerID: [20]byte{'s'}}).Encode())
+	n := (len(s.content) + testPieceLength - 1) / testPieceLength
+	have := bitfield.New(n)
+	for i := 0; i < n; i++ {
+		if s.pieces == nil || s.pieces(i) {
+			have.Set(i)
+		}
+	}
+	if peer.WriteMessage(conn, &peer.Message{ID: peer.MsgBitfield, Payload: have.Bytes()}) != nil {
+		return
+	}
+	for {
+		m, err := peer.ReadMessage(conn, peer.MessageLimits{})
+		if err != nil {
+			return
+		}
+		var reply []*peer.Message
+		switch {
+		case m == nil:
+		case m.ID == peer.MsgInterested && !s.choking:
+			reply = append(reply, &peer.Message{ID: peer.MsgUnchoke})
+		case m.ID == peer.MsgRequest && !s.silent:
+			start := int(m.Index)*testPieceLength + int(m.Begin)
+			block := append([]byte(nil), s.content[start:start+int(m.Length)]...)
+			if s.corrupt {
+				block[0] ^= 0xff
+			}
+			reply = append(reply, &peer.Message{ID: peer.MsgPiece, Index: m.Index, Begin: m.Begin, Payload: block})
+			if s.served.Add(1) == s.chokeAfter {
+				reply = append(reply, &peer.Message{ID: peer.MsgChoke}, &peer.Message{ID: peer.MsgUnchoke})
+			}
+		}
+		for _, r := range reply {
+			if peer.WriteMessage(conn, r) != nil {
+				return
+			}
+		}
+	}
+}
+
+// swarm dials its seeders by name over in-memory pipes; other names are refused.
+type swarm map[string]*seeder
+
+func (sw swarm) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	s, ok := sw[addr]
+	if !ok {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: syscall.ECONNREFUSED}
+	}
+	local, remote := net.Pipe()
+	go s.serve(remote)
+	return local, nil
+}
+
+func TestDownload(t *testing.T) {
+	meta, content := testTorrent(t, 5*testPieceLength+1000)
+	sw := swarm{
+		"bad":  {content: content, infoHash: meta.InfoHash, corrupt: true},
+		"even": {content: content, infoHash: meta.InfoHash, pieces: func(i int) bool { return i%2 == 0 }, chokeAfter: 3},
+		"full": {content: content, infoHash: meta.InfoHash},
+	}
+	var last atomic.Int32
+	cfg := Config{
+		Dialer:   sw,
+		MaxPeers: 2,
+		Progress: func(verified, total int) {
+			if total != 6 {
+				t.Errorf("Progress total = %d", total)
+			}
+			last.Store(int32(verified))
+		},
+	}
+	dir := filepath.Join(t.TempDir(), "out")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	path, err := Download(ctx, meta, []string{"dead", "bad", "even", "full"}, dir, cfg)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if path != filepath.Join(dir, "file.bin") {
+		t.Errorf("path = %s", path)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes that differ from the %d-byte content", len(got), len(content))
+	}
+	if last.Load() != 6 {
+		t.Errorf("last Progress = %d, want 6", last.Load())
+	}
+	if sw["even"].served.Load() == 0 {
+		t.Error("partial seeder was not used")
+	}
+}
+
+func TestDownload_Errors(t *testing.T) {
+	meta, content := testTorrent(t, 3*testPieceLength)
+	multi := *meta
+	multi.Info.Files = []torrent.File{{Path: []string{"a"}, Length: 1}}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		meta  *torrent.Meta
+		peers swarm
+		want  error
+	}{
+		{"multi-file", context.Background(), &multi, nil, ErrUnsupported},
+		{"no peers", context.Background(), meta, nil, ErrPeersExhausted},
+		{"corrupt", context.Background(), meta, swarm{"p": {content: content, infoHash: meta.InfoHash, corrupt: true}}, ErrBadPiece},
+		{"stalled", context.Background(), meta, swarm{"p": {content: content, infoHash: meta.InfoHash, silent: true}}, ErrStalled},
+		{"choking", context.Background(), meta, swarm{"p": {content: content, infoHash: meta.InfoHash, choking: true}}, ErrIdle},
+		{"nothing useful", context.Background(), meta, swarm{"p": {content: content, infoHash: meta.InfoHash, pieces: func(int) bool { return false }}}, ErrIdle},
+		{"wrong torrent", context.Background(), meta, swarm{"p": {content: content, infoHash: [20]byte{1}}}, peer.ErrInfoHashMismatch},
+		{"cancelled", cancelled, meta, swarm{"p": {content: content, infoHash: meta.InfoHash, silent: true}}, context.Canceled},
+	}
+	for _, tt := range tests {
+		cfg := Config{Dialer: tt.peers, BlockTimeout: 50 * time.Millisecond, IdleTimeout: 50 * time.Millisecond}
+		_, err := Download(tt.ctx, tt.meta, []string{"p"}, t.TempDir(), cfg)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDownload_UnsafeName(t *testing.T) {
+	meta, _ := testTorrent(t, 1000)
+	for _, name := range []string{"../escape", "a/b", "/abs", "", "CON", "bad\x01name", "trailing."} {
+		m := *meta
+		m.Info.Name = name
+		var pe *torrent.PathError
+		if _, err := Download(context.Background(), &m, nil, t.TempDir(), Config{}); !errors.As(err, &pe) {
+			t.Errorf("name %q: err = %v, want a *torrent.PathError", name, err)
+		}
+	}
+}
+
+func TestDownload_ChokedPeersGiveUpSlots(t *testing.T) {
+	meta, content := testTorrent(t, 2*testPieceLength)
+	sw := swarm{
+		"choker1": {content: content, infoHash: meta.InfoHash, choking: true},
+		"choker2": {content: content, infoHash: meta.InfoHash, choking: true},
+		"full":    {content: content, infoHash: meta.InfoHash},
+	}
+	// Both slots go to peers that never unchoke; the seeder is only reached once they give up.
+	cfg := Config{Dialer: sw, MaxPeers: 2, IdleTimeout: 50 * time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	path, err := Download(ctx, meta, []string{"choker1", "choker2", "full"}, t.TempDir(), cfg)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("downloaded content differs (%v)", err)
+	}
+}
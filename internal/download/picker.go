@@ -0,0 +1,103 @@
+package download
+
+import (
+	"sync"
+
+	"github.com/harioms1522/BitSwift/internal/bitfield"
+)
+
+// picker tracks which pieces are verified and which are being downloaded, and hands out
+// the missing pieces in order, each to one peer at a time.
+type picker struct {
+	mu       sync.Mutex
+	verified *bitfield.Bitfield
+	busy     *bitfield.Bitfield // assigned to a peer
+	wake     chan struct{}      // closed and replaced when a piece is released or verified
+	done     chan struct{}      // closed when every piece is verified, or on fail
+	err      error
+}
+
+func newPicker(n int) *picker {
+	p := &picker{
+		verified: bitfield.New(n),
+		busy:     bitfield.New(n),
+		wake:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if n == 0 {
+		close(p.done)
+	}
+	return p
+}
+
+// pick assigns the first piece that theirs has and that is neither verified nor assigned,
+// and returns it, or -1 if there is none.
+func (p *picker) pick(theirs *bitfield.Bitfield) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := theirs.Difference(p.verified).Difference(p.busy).NextSet(0)
+	if i >= 0 {
+		p.busy.Set(i)
+	}
+	return i
+}
+
+// release returns an assigned piece to the missing pieces, for another peer to download.
+func (p *picker) release(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.busy.Clear(i)
+	p.signal()
+}
+
+// complete marks an assigned piece verified and returns the number of verified pieces.
+func (p *picker) complete(i int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.busy.Clear(i)
+	p.verified.Set(i)
+	if p.verified.Full() {
+		p.finish(nil)
+	}
+	p.signal()
+	return p.verified.Count()
+}
+
+// fail ends the download with err.
+func (p *picker) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finish(err)
+}
+
+func (p *picker) finish(err error) {
+	select {
+	case <-p.done:
+	default:
+		p.err = err
+		close(p.done)
+	}
+}
+
+func (p *picker) signal() {
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// changed returns a channel closed the next time a piece is released or verified.
+func (p *picker) changed() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.wake
+}
+
+// Done is closed when the download has finished; Err then tells whether it failed.
+func (p *picker) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *picker) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
@@ -0,0 +1,87 @@
+package download
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/harioms1522/BitSwift/internal/bitfield"
+)
+
+func TestPicker(t *testing.T) {
+	p := newPicker(4)
+	all := bitfield.New(4)
+	all.SetAll()
+	odd := bitfield.New(4)
+	odd.Set(1)
+	odd.Set(3)
+
+	// Pieces go out in order, each to one peer.
+	if got := p.pick(odd); got != 1 {
+		t.Errorf("pick(odd) = %d, want 1", got)
+	}
+	if got := p.pick(all); got != 0 {
+		t.Errorf("pick(all) = %d, want 0", got)
+	}
+	if got := p.pick(odd); got != 3 {
+		t.Errorf("second pick(odd) = %d, want 3", got)
+	}
+	if got := p.pick(odd); got != -1 {
+		t.Errorf("pick(odd) with both assigned = %d, want -1", got)
+	}
+
+	// A released piece is handed out again and wakes waiting peers.
+	wake := p.changed()
+	p.release(3)
+	select {
+	case <-wake:
+	default:
+		t.Error("release did not wake")
+	}
+	if got := p.pick(odd); got != 3 {
+		t.Errorf("pick after release = %d, want 3", got)
+	}
+
+	for _, i := range []int{0, 1, 3} {
+		p.complete(i)
+	}
+	if got := p.pick(odd); got != -1 {
+		t.Errorf("pick of verified pieces = %d", got)
+	}
+	select {
+	case <-p.Done():
+		t.Fatal("done before every piece is verified")
+	default:
+	}
+	if got := p.pick(all); got != 2 {
+		t.Fatalf("pick(all) = %d, want 2", got)
+	}
+	if n := p.complete(2); n != 4 {
+		t.Errorf("complete = %d, want 4", n)
+	}
+	select {
+	case <-p.Done():
+	default:
+		t.Fatal("not done after every piece is verified")
+	}
+	if p.Err() != nil {
+		t.Errorf("Err = %v", p.Err())
+	}
+}
+
+func TestPicker_Fail(t *testing.T) {
+	errDisk := errors.New("disk full")
+	p := newPicker(2)
+	p.fail(errDisk)
+	p.fail(errors.New("second"))
+	<-p.Done()
+	if p.Err() != errDisk {
+		t.Errorf("Err = %v, want the first failure", p.Err())
+	}
+
+	empty := newPicker(0)
+	select {
+	case <-empty.Done():
+	default:
+		t.Error("empty torrent not done")
+	}
+}
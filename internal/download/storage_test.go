@@ -0,0 +1,86 @@
+package download
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	meta, content := testTorrent(t, 3*testPieceLength+100)
+	layout, err := meta.Layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "out.bin")
+	s, err := createStorage(path, layout, meta.Info.Pieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	piece := func(i int) []byte {
+		return content[layout.PieceOffset(i) : layout.PieceOffset(i)+layout.PieceSize(i)]
+	}
+
+	bad := append([]byte(nil), piece(1)...)
+	bad[len(bad)-1] ^= 1
+	tests := []struct {
+		name  string
+		index int
+		data  []byte
+		want  bool
+	}{
+		{"first", 0, piece(0), true},
+		{"last, short", 3, piece(3), true},
+		{"corrupt", 1, bad, false},
+		{"other piece", 1, piece(2), false},
+		{"truncated", 3, piece(3)[:50], false},
+	}
+	for _, tt := range tests {
+		if got := s.verify(tt.index, tt.data); got != tt.want {
+			t.Errorf("%s: verify = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Pieces land at their offsets whatever order they complete in.
+	for _, i := range []int{3, 1, 0, 2} {
+		if err := s.writePiece(i, piece(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("file content differs")
+	}
+}
+
+func TestStorage_Preallocate(t *testing.T) {
+	meta, _ := testTorrent(t, 2*testPieceLength+7)
+	layout, err := meta.Layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "out.bin")
+	// An existing longer file is cut to the torrent's size.
+	if err := os.WriteFile(path, make([]byte, 5*testPieceLength), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := createStorage(path, layout, meta.Info.Pieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != layout.TotalLength {
+		t.Errorf("size = %d, want %d", fi.Size(), layout.TotalLength)
+	}
+}
@@ -0,0 +1,267 @@
+// Package magnet parses and generates magnet URIs (BEP 9, with the BEP 53 so= parameter
+// and BEP 52 v2 hashes).
+package magnet
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/harioms1522/BitSwift/internal/torrent"
+)
+
+// ErrNoInfoHash is returned for a magnet URI without a BitTorrent xt parameter.
+var ErrNoInfoHash = errors.New("magnet: no urn:btih or urn:btmh exact topic")
+
+// sha256Multihash is the multihash prefix of a v2 info hash: function 0x12 (SHA-256), 32 bytes.
+const sha256Multihash = "1220"
+
+// Magnet is a parsed magnet URI. At least one of InfoHash and InfoHashV2 is set.
+type Magnet struct {
+	InfoHash   [20]byte    // xt=urn:btih, the v1 info hash
+	InfoHashV2 [32]byte    // xt=urn:btmh, the v2 info hash
+	Name       string      // dn, display name (optional)
+	Length     int64       // xl, total size in bytes; 0 if unknown
+	Trackers   []string    // tr
+	WebSeeds   []string    // ws
+	Peers      []string    // x.pe, host:port of peers to contact directly
+	Select     []FileRange // so, files to download; empty means all
+}
+
+// FileRange is an inclusive range of file indexes selected with so=.
+type FileRange struct {
+	First, Last int
+}
+
+// HasV1 reports whether the magnet carries a v1 info hash.
+func (m *Magnet) HasV1() bool {
+	return m.InfoHash != [20]byte{}
+}
+
+// HasV2 reports whether the magnet carries a v2 info hash.
+func (m *Magnet) HasV2() bool {
+	return m.InfoHashV2 != [32]byte{}
+}
+
+// AnnounceHash returns the 20-byte hash used with trackers and peers: the v1 info hash, or
+// the truncated v2 info hash for a v2-only magnet.
+func (m *Magnet) AnnounceHash() [20]byte {
+	if m.HasV1() {
+		return m.InfoHash
+	}
+	var h [20]byte
+	copy(h[:], m.InfoHashV2[:])
+	return h
+}
+
+// Selected reports whether file index i should be downloaded.
+func (m *Magnet) Selected(i int) bool {
+	if len(m.Select) == 0 {
+		return true
+	}
+	for _, r := range m.Select {
+		if i >= r.First && i <= r.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse parses a magnet URI. Unknown parameters are ignored; numbered variants such as
+// tr.1 are treated like their base name.
+func Parse(uri string) (*Magnet, error) {
+	rest, ok := strings.CutPrefix(uri, "magnet:?")
+	if !ok {
+		return nil, errors.New("magnet: not a magnet URI")
+	}
+	m := new(Magnet)
+	// Parameters are read in order, so trackers keep the order of the URI.
+	for _, param := range strings.Split(rest, "&") {
+		if param == "" {
+			continue
+		}
+		key, v, _ := strings.Cut(param, "=")
+		v, err := url.QueryUnescape(v)
+		if err != nil {
+			return nil, fmt.Errorf("magnet: invalid %s parameter: %w", key, err)
+		}
+		if err := m.set(baseKey(key), v); err != nil {
+			return nil, err
+		}
+	}
+	if !m.HasV1() && !m.HasV2() {
+		return nil, ErrNoInfoHash
+	}
+	return m, nil
+}
+
+// baseKey strips a numeric suffix, as in "tr.1" or "xt.2".
+func baseKey(key string) string {
+	base, n, ok := strings.Cut(key, ".")
+	if ok {
+		if _, err := strconv.Atoi(n); err == nil {
+			return base
+		}
+	}
+	return key
+}
+
+func (m *Magnet) set(key, v string) error {
+	switch key {
+	case "xt":
+		return m.setTopic(v)
+	case "dn":
+		m.Name = v
+	case "xl":
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("magnet: invalid xl %q", v)
+		}
+		m.Length = n
+	case "tr":
+		m.Trackers = appendUnique(m.Trackers, v)
+	case "ws":
+		m.WebSeeds = appendUnique(m.WebSeeds, v)
+	case "x.pe":
+		m.Peers = appendUnique(m.Peers, v)
+	case "so":
+		ranges, err := parseSelect(v)
+		if err != nil {
+			return err
+		}
+		m.Select = append(m.Select, ranges...)
+	}
+	return nil
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, s := range list {
+		if s == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// setTopic parses one xt value. Exact topics of other networks are ignored.
+func (m *Magnet) setTopic(v string) error {
+	switch {
+	case strings.HasPrefix(v, "urn:btih:"):
+		h, err := parseBTIH(strings.TrimPrefix(v, "urn:btih:"))
+		if err != nil {
+			return err
+		}
+		m.InfoHash = h
+	case strings.HasPrefix(v, "urn:btmh:"):
+		mh := strings.ToLower(strings.TrimPrefix(v, "urn:btmh:"))
+		rest, ok := strings.CutPrefix(mh, sha256Multihash)
+		b, err := hex.DecodeString(rest)
+		if !ok || err != nil || len(b) != 32 {
+			return fmt.Errorf("magnet: invalid urn:btmh %q", mh)
+		}
+		copy(m.InfoHashV2[:], b)
+	}
+	return nil
+}
+
+// parseBTIH decodes a v1 info hash written as 40 hex digits or 32 base32 characters.
+func parseBTIH(s string) ([20]byte, error) {
+	var h [20]byte
+	var b []byte
+	var err error
+	switch len(s) {
+	case 40:
+		b, err = hex.DecodeString(s)
+	case 32:
+		b, err = base32.StdEncoding.DecodeString(strings.ToUpper(s))
+	default:
+		err = errors.New("wrong length")
+	}
+	if err != nil {
+		return h, fmt.Errorf("magnet: invalid urn:btih %q: %v", s, err)
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// parseSelect parses an so= list such as "0,2,4-6".
+func parseSelect(v string) ([]FileRange, error) {
+	var ranges []FileRange
+	for _, part := range strings.Split(v, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		a, err1 := strconv.Atoi(first)
+		b := a
+		var err2 error
+		if isRange {
+			b, err2 = strconv.Atoi(last)
+		}
+		if err1 != nil || err2 != nil || a < 0 || b < a {
+			return nil, fmt.Errorf("magnet: invalid so %q", v)
+		}
+		ranges = append(ranges, FileRange{First: a, Last: b})
+	}
+	return ranges, nil
+}
+
+// String returns the magnet URI.
+func (m *Magnet) String() string {
+	var params []string
+	if m.HasV1() {
+		params = append(params, "xt=urn:btih:"+hex.EncodeToString(m.InfoHash[:]))
+	}
+	if m.HasV2() {
+		params = append(params, "xt=urn:btmh:"+sha256Multihash+hex.EncodeToString(m.InfoHashV2[:]))
+	}
+	if m.Name != "" {
+		params = append(params, "dn="+url.QueryEscape(m.Name))
+	}
+	if m.Length > 0 {
+		params = append(params, "xl="+strconv.FormatInt(m.Length, 10))
+	}
+	for _, tr := range m.Trackers {
+		params = append(params, "tr="+url.QueryEscape(tr))
+	}
+	for _, ws := range m.WebSeeds {
+		params = append(params, "ws="+url.QueryEscape(ws))
+	}
+	for _, pe := range m.Peers {
+		params = append(params, "x.pe="+url.QueryEscape(pe))
+	}
+	if len(m.Select) > 0 {
+		parts := make([]string, len(m.Select))
+		for i, r := range m.Select {
+			parts[i] = strconv.Itoa(r.First)
+			if r.Last != r.First {
+				parts[i] += "-" + strconv.Itoa(r.Last)
+			}
+		}
+		params = append(params, "so="+strings.Join(parts, ","))
+	}
+	return "magnet:?" + strings.Join(params, "&")
+}
+
+// FromMeta returns a magnet URI for a parsed torrent, with its info hashes, name, size
+// and trackers.
+func FromMeta(meta *torrent.Meta) *Magnet {
+	m := &Magnet{
+		Name:     meta.Info.Name,
+		Length:   meta.TotalSize(),
+		Trackers: meta.TrackerURLs(),
+	}
+	for _, f := range meta.Info.Files {
+		if f.IsPadding() {
+			m.Length -= f.Length // xl is the size of the content, without padding
+		}
+	}
+	if meta.IsV1() || !meta.IsV2() {
+		m.InfoHash = meta.InfoHash
+	}
+	if meta.IsV2() {
+		m.InfoHashV2 = meta.InfoHashV2
+	}
+	return m
+}
@@ -0,0 +1,163 @@
+package magnet
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/harioms1522/BitSwift/internal/torrent"
+)
+
+func mustHash20(s string) [20]byte {
+	var h [20]byte
+	b, _ := hex.DecodeString(s)
+	copy(h[:], b)
+	return h
+}
+
+func TestParse(t *testing.T) {
+	uri := "magnet:?xt=urn:btih:F7B11299223DA7AA42221D352BF21135524AF224&dn=test+file%20name&xl=100" +
+		"&tr=http%3A%2F%2Ftracker%2Fannounce&tr.1=udp://backup:80&tr=http%3A%2F%2Ftracker%2Fannounce" +
+		"&ws=http://seed/file&x.pe=10.0.0.1:6881&x.pe=[::1]:6881&so=0,2,4-6&xt=urn:ed2k:abc&unknown=1"
+	m, err := Parse(uri)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := &Magnet{
+		InfoHash: mustHash20("f7b11299223da7aa42221d352bf21135524af224"),
+		Name:     "test file name",
+		Length:   100,
+		Trackers: []string{"http://tracker/announce", "udp://backup:80"},
+		WebSeeds: []string{"http://seed/file"},
+		Peers:    []string{"10.0.0.1:6881", "[::1]:6881"},
+		Select:   []FileRange{{0, 0}, {2, 2}, {4, 6}},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("Parse =\n%+v\nwant\n%+v", m, want)
+	}
+	if !m.HasV1() || m.HasV2() || m.AnnounceHash() != m.InfoHash {
+		t.Errorf("HasV1, HasV2 = %v, %v", m.HasV1(), m.HasV2())
+	}
+	for i, sel := range []bool{true, false, true, false, true, true, true, false} {
+		if m.Selected(i) != sel {
+			t.Errorf("Selected(%d) = %v, want %v", i, !sel, sel)
+		}
+	}
+}
+
+func TestParse_Base32AndV2(t *testing.T) {
+	// The same hash as 32 base32 characters, in either case.
+	for _, h := range []string{"66YRFGJCHWT2UQRCDU2SX4QRGVJEV4RE", "66yrfgjchwt2uqrcdu2sx4qrgvjev4re"} {
+		m, err := Parse("magnet:?xt=urn:btih:" + h)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", h, err)
+		}
+		if m.InfoHash != mustHash20("f7b11299223da7aa42221d352bf21135524af224") {
+			t.Errorf("base32 hash = %x", m.InfoHash)
+		}
+	}
+
+	v2 := "8f8ed3250ff35ad686fea60203375ed18d2cf23ff74d7f672a2fd9c7ae86d8bf"
+	m, err := Parse("magnet:?xt=urn:btmh:1220" + v2)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if m.HasV1() || !m.HasV2() || hex.EncodeToString(m.InfoHashV2[:]) != v2 {
+		t.Errorf("v2 magnet = %+v", m)
+	}
+	if got := m.AnnounceHash(); hex.EncodeToString(got[:]) != v2[:40] {
+		t.Errorf("AnnounceHash = %x, want truncated v2 hash", got)
+	}
+	if m.Selected(100) != true {
+		t.Error("no so= should select every file")
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []string{
+		"http://example.com/",
+		"magnet:?dn=name",
+		"magnet:?xt=urn:ed2k:abcdef",
+		"magnet:?xt=urn:btih:1234",
+		"magnet:?xt=urn:btih:zz" + "b11299223da7aa42221d352bf21135524af224",
+		"magnet:?xt=urn:btmh:1114" + "f7b11299223da7aa42221d352bf21135524af224",
+		"magnet:?xt=urn:btih:f7b11299223da7aa42221d352bf21135524af224&xl=-1",
+		"magnet:?xt=urn:btih:f7b11299223da7aa42221d352bf21135524af224&so=3-1",
+		"magnet:?xt=urn:btih:f7b11299223da7aa42221d352bf21135524af224&so=a",
+		"magnet:?xt=urn:btih:f7b11299223da7aa42221d352bf21135524af224&dn=%zz",
+	}
+	for _, uri := range tests {
+		if _, err := Parse(uri); err == nil {
+			t.Errorf("Parse(%q) succeeded", uri)
+		}
+	}
+	if _, err := Parse("magnet:?dn=x"); !errors.Is(err, ErrNoInfoHash) {
+		t.Errorf("Parse without xt = %v, want ErrNoInfoHash", err)
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	m := &Magnet{
+		InfoHash:   mustHash20("f7b11299223da7aa42221d352bf21135524af224"),
+		InfoHashV2: [32]byte{1, 2, 3},
+		Name:       "a & b/c",
+		Length:     42,
+		Trackers:   []string{"http://t/announce?x=1&y=2", "udp://u:80"},
+		WebSeeds:   []string{"http://seed/"},
+		Peers:      []string{"1.2.3.4:5"},
+		Select:     []FileRange{{1, 1}, {3, 5}},
+	}
+	s := m.String()
+	want := "magnet:?xt=urn:btih:f7b11299223da7aa42221d352bf21135524af224" +
+		"&xt=urn:btmh:12200102030000000000000000000000000000000000000000000000000000000000" +
+		"&dn=a+%26+b%2Fc&xl=42&tr=http%3A%2F%2Ft%2Fannounce%3Fx%3D1%26y%3D2&tr=udp%3A%2F%2Fu%3A80" +
+		"&ws=http%3A%2F%2Fseed%2F&x.pe=1.2.3.4%3A5&so=1,3-5"
+	if s != want {
+		t.Errorf("String =\n%s\nwant\n%s", s, want)
+	}
+	back, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(String()): %v", err)
+	}
+	if !reflect.DeepEqual(back, m) {
+		t.Errorf("round trip =\n%+v\nwant\n%+v", back, m)
+	}
+}
+
+func TestFromMeta(t *testing.T) {
+	for _, tt := range []struct {
+		file       string
+		v1, v2     bool
+		length     int64
+		announceV2 bool
+	}{
+		{"valid.torrent", true, false, 100, false},
+		{"v2.torrent", false, true, 80005, true},
+		{"hybrid.torrent", true, true, 80005, false},
+	} {
+		data, err := os.ReadFile(filepath.Join("..", "..", "testdata", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta, err := torrent.ParseFile(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := FromMeta(meta)
+		if m.HasV1() != tt.v1 || m.HasV2() != tt.v2 || m.Length != tt.length || m.Name != meta.Info.Name {
+			t.Errorf("%s: FromMeta = %+v", tt.file, m)
+		}
+		if m.AnnounceHash() != meta.InfoHash {
+			t.Errorf("%s: AnnounceHash = %x, want the torrent's InfoHash %x", tt.file, m.AnnounceHash(), meta.InfoHash)
+		}
+		if !reflect.DeepEqual(m.Trackers, meta.TrackerURLs()) {
+			t.Errorf("%s: Trackers = %v, want %v", tt.file, m.Trackers, meta.TrackerURLs())
+		}
+		if back, err := Parse(m.String()); err != nil || !reflect.DeepEqual(back, m) {
+			t.Errorf("%s: Parse(String()) = %+v, %v", tt.file, back, err)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// Package metadata implements the ut_metadata extension (BEP 9), which lets a client that
+// only knows a torrent's info hash, as from a magnet link, fetch the info dictionary from
+// its peers. Messages travel over the extension protocol (BEP 10).
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/harioms1522/BitSwift/internal/bencode"
+	"github.com/harioms1522/BitSwift/internal/peer"
+)
+
+const (
+	// PieceSize is the size of every metadata piece but the last.
+	PieceSize = 16 * 1024
+	// MaxSize is the largest info dictionary Fetch accepts.
+	MaxSize = 16 << 20
+
+	// Name is the extension name of ut_metadata in the extension handshake.
+	Name = "ut_metadata"
+
+	maxMessageSize = 1 << 20 // longest peer wire message read; larger ones end the connection
+	maxInFlight    = 16      // metadata pieces requested at once
+)
+
+// ut_metadata message types.
+const (
+	msgRequest = 0
+	msgData    = 1
+	msgReject  = 2
+)
+
+var (
+	ErrNotSupported = errors.New("metadata: peer does not support ut_metadata")
+	ErrRejected     = errors.New("metadata: peer rejected a metadata request")
+	ErrHashMismatch = errors.New("metadata: info dictionary does not match the info hash")
+)
+
+// Verify reports whether info is the info dictionary identified by infoHash: its SHA-1 hash,
+// or for a v2 torrent the truncated SHA-256 hash.
+func Verify(info []byte, infoHash [20]byte) bool {
+	if sha1.Sum(info) == infoHash {
+		return true
+	}
+	h := sha256.Sum256(info)
+	return bytes.Equal(h[:20], infoHash[:])
+}
+
+// message is the bencoded header of a ut_metadata message; a data message is followed by
+// the piece itself.
+type message struct {
+	Type      int64 `bencode:"msg_type"`
+	Piece     int64 `bencode:"piece"`
+	TotalSize int64 `bencode:"total_size,omitempty"`
+}
+
+// wire reads and writes extension protocol messages on a peer connection after the handshake.
+type wire struct {
+	rw io.ReadWriter
+}
+
+// read returns the next extended message, skipping keep-alives and all other peer wire
+// messages.
+func (w *wire) read() (extID byte, payload []byte, err error) {
+	for {
+		m, err := peer.ReadMessage(w.rw, peer.MessageLimits{MaxSize: maxMessageSize})
+		if err != nil {
+			return 0, nil, err
+		}
+		if m != nil && m.ID == peer.MsgExtended {
+			return m.ExtendedID, m.Payload, nil
+		}
+	}
+}
+
+// write sends an extended message whose payload is followed by data.
+func (w *wire) write(extID byte, payload, data []byte) error {
+	return peer.WriteMessage(w.rw, &peer.Message{
+		ID:         peer.MsgExtended,
+		ExtendedID: extID,
+		Payload:    append(payload, data...),
+	})
+}
+
+// writeHandshake sends an extension handshake.
+func (w *wire) writeHandshake(h *peer.ExtendedHandshake) error {
+	payload, err := h.Encode()
+	if err != nil {
+		return err
+	}
+	return w.write(peer.ExtendedHandshakeID, payload, nil)
+}
+
+// writeMessage sends a ut_metadata message followed by data.
+func (w *wire) writeMessage(extID byte, m message, data []byte) error {
+	payload, err := bencode.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return w.write(extID, payload, data)
+}
+
+// decodeMessage splits a ut_metadata payload into its header and trailing piece data.
+func decodeMessage(payload []byte) (message, []byte, error) {
+	var m message
+	dec := bencode.NewDecoder(bytes.NewReader(payload))
+	dec.SetOptions(bencode.DecoderOptions{MaxDepth: 2, MaxListLen: 16, MaxTotalAllocs: 64})
+	if err := dec.Decode(&m); err != nil {
+		return m, nil, fmt.Errorf("metadata: invalid ut_metadata message: %w", err)
+	}
+	return m, payload[dec.InputOffset():], nil
+}
+
+// watch applies ctx's deadline to conn and unblocks pending reads and writes when ctx is
+// done. The returned function detaches conn from ctx and, unless ctx ended first, clears
+// the deadline so the connection can be used further.
+func watch(ctx context.Context, conn net.Conn) (stop func()) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	detach := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	return func() {
+		if detach() {
+			conn.SetDeadline(time.Time{})
+		}
+	}
+}
+
+// ctxErr prefers the context's error over the I/O error it caused.
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// fetcher is the state of one Fetch.
+type fetcher struct {
+	w        *wire
+	ext      *peer.Extensions
+	infoHash [20]byte
+
+	remoteID  byte
+	info      []byte
+	have      []bool
+	next      int // next piece to request
+	received  int
+	numPieces int
+	done      bool
+}
+
+// start requests the first pieces once the peer's extension handshake has arrived.
+func (f *fetcher) start() error {
+	id, ok := f.ext.RemoteID(Name)
+	if !ok {
+		return ErrNotSupported
+	}
+	size := f.ext.Remote().MetadataSize
+	if size <= 0 || size > MaxSize {
+		return fmt.Errorf("metadata: peer reports invalid metadata size %d", size)
+	}
+	f.remoteID = id
+	f.info = make([]byte, size)
+	f.numPieces = int((size + PieceSize - 1) / PieceSize)
+	f.have = make([]bool, f.numPieces)
+	for f.next < f.numPieces && f.next < maxInFlight {
+		if err := f.request(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fetcher) request() error {
+	f.next++
+	return f.w.writeMessage(f.remoteID, message{Type: msgRequest, Piece: int64(f.next - 1)}, nil)
+}
+
+// handle is the ut_metadata handler registered for Fetch.
+func (f *fetcher) handle(payload []byte) error {
+	m, data, err := decodeMessage(payload)
+	if err != nil {
+		return err
+	}
+	switch m.Type {
+	case msgRequest:
+		if id, ok := f.ext.RemoteID(Name); ok {
+			return f.w.writeMessage(id, message{Type: msgReject, Piece: m.Piece}, nil)
+		}
+	case msgReject:
+		return ErrRejected
+	case msgData:
+		if f.info == nil {
+			return errors.New("metadata: data before the extension handshake")
+		}
+		if m.Piece < 0 || m.Piece >= int64(f.numPieces) || f.have[m.Piece] {
+			return fmt.Errorf("metadata: unexpected piece %d", m.Piece)
+		}
+		start := m.Piece * PieceSize
+		size := min(PieceSize, int64(len(f.info))-start)
+		if int64(len(data)) != size || (m.TotalSize != 0 && m.TotalSize != int64(len(f.info))) {
+			return fmt.Errorf("metadata: piece %d has %d bytes, want %d", m.Piece, len(data), size)
+		}
+		copy(f.info[start:], data)
+		f.have[m.Piece] = true
+		if f.received++; f.received == f.numPieces {
+			if !Verify(f.info, f.infoHash) {
+				return ErrHashMismatch
+			}
+			f.done = true
+			return nil
+		}
+		if f.next < f.numPieces {
+			return f.request()
+		}
+	}
+	return nil
+}
+
+// Fetch downloads the info dictionary identified by infoHash from the peer on conn, which
+// must have completed a handshake in which both sides set peer.ExtensionProtocol.
+// It requests every metadata piece, assembles them and checks the result with Verify.
+// Requests the peer makes for our metadata meanwhile are rejected.
+func Fetch(ctx context.Context, conn net.Conn, infoHash [20]byte) ([]byte, error) {
+	defer watch(ctx, conn)()
+	f := &fetcher{w: &wire{rw: conn}, ext: new(peer.Extensions), infoHash: infoHash}
+	if _, err := f.ext.Register(Name, f.handle); err != nil {
+		return nil, err
+	}
+	hs := f.ext.Handshake()
+	hs.V = "BitSwift"
+	if err := f.w.writeHandshake(hs); err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	for !f.done {
+		extID, payload, err := f.w.read()
+		if err == io.EOF && f.ext.Remote() == nil {
+			return nil, ErrNotSupported
+		}
+		if err == nil {
+			err = f.ext.Handle(extID, payload)
+		}
+		if err == nil && extID == peer.ExtendedHandshakeID && f.info == nil {
+			err = f.start()
+		}
+		if err != nil {
+			return nil, ctxErr(ctx, err)
+		}
+	}
+	return f.info, nil
+}
+
+// Serve answers the peer's ut_metadata requests on conn with pieces of info, our bencoded
+// info dictionary, until the peer closes the connection or ctx is done. The handshake must
+// have set peer.ExtensionProtocol on both sides. Other messages are ignored. Serve returns
+// nil when the peer closes the connection.
+func Serve(ctx context.Context, conn net.Conn, info []byte) error {
+	defer watch(ctx, conn)()
+	w := &wire{rw: conn}
+	ext := new(peer.Extensions)
+	numPieces := int64(len(info)+PieceSize-1) / PieceSize
+	_, err := ext.Register(Name, func(payload []byte) error {
+		m, _, err := decodeMessage(payload)
+		if err != nil {
+			return err
+		}
+		id, ok := ext.RemoteID(Name)
+		if m.Type != msgRequest || !ok {
+			return nil
+		}
+		if m.Piece < 0 || m.Piece >= numPieces {
+			return w.writeMessage(id, message{Type: msgReject, Piece: m.Piece}, nil)
+		}
+		start := m.Piece * PieceSize
+		piece := info[start:min(start+PieceSize, int64(len(info)))]
+		return w.writeMessage(id, message{Type: msgData, Piece: m.Piece, TotalSize: int64(len(info))}, piece)
+	})
+	if err != nil {
+		return err
+	}
+	hs := ext.Handshake()
+	hs.V = "BitSwift"
+	hs.MetadataSize = int64(len(info))
+	if err := w.writeHandshake(hs); err != nil {
+		return ctxErr(ctx, err)
+	}
+	for {
+		extID, payload, err := w.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			err = ext.Handle(extID, payload)
+		}
+		if err != nil {
+			return ctxErr(ctx, err)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harioms1522/BitSwift/internal/bencode"
+	"github.com/harioms1522/BitSwift/internal/peer"
+	"github.com/harioms1522/BitSwift/internal/torrent"
+)
+
+// localID is the message ID of ut_metadata, the only extension Fetch and Serve register.
+const localID = 1
+
+// fakePeer accepts one connection, answers the handshake with the extension bit set (unless
+// plain is true) and hands the connection to serve. It returns the peer's address.
+func fakePeer(t *testing.T, infoHash [20]byte, plain bool, serve func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, peer.HandshakeLen)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		ours := &peer.Handshake{InfoHash: infoHash, PeerID: [20]byte{'f', 'a', 'k', 'e'}}
+		if !plain {
+			ours.Set(peer.ExtensionProtocol)
+		}
+		if _, err := conn.Write(ours.Encode()); err != nil {
+			return
+		}
+		serve(conn)
+	}()
+	return ln.Addr().String()
+}
+
+// dial connects to a fake peer as a client that supports the extension protocol.
+func dial(t *testing.T, addr string, infoHash [20]byte) (net.Conn, *peer.Handshake) {
+	t.Helper()
+	our := &peer.Handshake{InfoHash: infoHash}
+	our.Set(peer.ExtensionProtocol)
+	conn, their, err := peer.Dial(addr, our, infoHash, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, their
+}
+
+// testInfo returns a valid info dictionary of about size bytes and its SHA-1 hash.
+func testInfo(t *testing.T, size int) ([]byte, [20]byte) {
+	t.Helper()
+	pieces := bytes.Repeat([]byte{0xab}, max(size-100, 0)/20*20)
+	info, err := bencode.Marshal(map[string]any{
+		"name":         "meta test",
+		"piece length": 16384,
+		"length":       int64(len(pieces) / 20 * 16384),
+		"pieces":       pieces,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info, sha1.Sum(info)
+}
+
+func TestFetch(t *testing.T) {
+	// Sizes around the piece boundary: one piece, exactly one, several with a short last
+	// piece, and more pieces than are requested at once.
+	for _, size := range []int{200, PieceSize + 100, 3*PieceSize + 500, (maxInFlight + 3) * PieceSize} {
+		info, hash := testInfo(t, size)
+		addr := fakePeer(t, hash, false, func(conn net.Conn) {
+			Serve(context.Background(), conn, info)
+		})
+		conn, their := dial(t, addr, hash)
+		if !their.Has(peer.ExtensionProtocol) {
+			t.Fatal("fake peer does not advertise the extension protocol")
+		}
+		got, err := Fetch(context.Background(), conn, hash)
+		if err != nil {
+			t.Fatalf("size %d: Fetch: %v", len(info), err)
+		}
+		if !bytes.Equal(got, info) {
+			t.Fatalf("size %d: Fetch returned different bytes", len(info))
+		}
+		meta, err := torrent.ParseInfo(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.InfoHash != hash || meta.Info.Name != "meta test" {
+			t.Errorf("size %d: ParseInfo = %x %q", len(info), meta.InfoHash, meta.Info.Name)
+		}
+	}
+}
+
+func TestFetch_TestdataTorrents(t *testing.T) {
+	for _, name := range []string{"valid.torrent", "v2.torrent", "hybrid.torrent"} {
+		data, err := os.ReadFile(filepath.Join("..", "..", "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := torrent.ParseFile(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info := []byte(want.InfoBytes)
+		// A v2-only torrent is found by its truncated v2 hash.
+		addr := fakePeer(t, want.InfoHash, false, func(conn net.Conn) {
+			Serve(context.Background(), conn, info)
+		})
+		conn, _ := dial(t, addr, want.InfoHash)
+		got, err := Fetch(context.Background(), conn, want.InfoHash)
+		if err != nil {
+			t.Fatalf("%s: Fetch: %v", name, err)
+		}
+		meta, err := torrent.ParseInfo(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.InfoHash != want.InfoHash || meta.InfoHashV2 != want.InfoHashV2 {
+			t.Errorf("%s: fetched info hashes %x %x", name, meta.InfoHash, meta.InfoHashV2)
+		}
+	}
+}
+
+func TestFetch_Errors(t *testing.T) {
+	info, hash := testInfo(t, 3*PieceSize)
+	other, _ := testInfo(t, 3*PieceSize+20)
+
+	tests := []struct {
+		name  string
+		plain bool
+		serve func(net.Conn)
+		want  error
+	}{
+		{"hash mismatch", false, func(conn net.Conn) { Serve(context.Background(), conn, other) }, ErrHashMismatch},
+		{"no ut_metadata", false, func(conn net.Conn) {
+			w := &wire{rw: conn}
+			w.writeHandshake(&peer.ExtendedHandshake{M: map[string]int64{"ut_pex": 1}})
+			w.read()
+		}, ErrNotSupported},
+		{"closed", true, func(conn net.Conn) {}, ErrNotSupported},
+		{"reject", false, func(conn net.Conn) {
+			w := &wire{rw: conn}
+			w.writeHandshake(&peer.ExtendedHandshake{M: map[string]int64{"ut_metadata": 3}, MetadataSize: int64(len(info))})
+			for {
+				extID, payload, err := w.read()
+				if err != nil {
+					return
+				}
+				if extID == 3 {
+					m, _, _ := decodeMessage(payload)
+					w.writeMessage(localID, message{Type: msgReject, Piece: m.Piece}, nil)
+				}
+			}
+		}, ErrRejected},
+	}
+	for _, tt := range tests {
+		addr := fakePeer(t, hash, tt.plain, tt.serve)
+		conn, _ := dial(t, addr, hash)
+		if _, err := Fetch(context.Background(), conn, hash); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Fetch = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestFetch_BadMessages(t *testing.T) {
+	info, hash := testInfo(t, 2*PieceSize)
+	tests := []struct {
+		name    string
+		size    int64
+		reply   message
+		data    []byte
+		wantErr string
+	}{
+		{"huge metadata", MaxSize + 1, message{}, nil, "invalid metadata size"},
+		{"piece out of range", int64(len(info)), message{Type: msgData, Piece: 9}, make([]byte, PieceSize), "unexpected piece 9"},
+		{"short piece", int64(len(info)), message{Type: msgData, Piece: 0}, make([]byte, 10), "piece 0 has 10 bytes"},
+	}
+	for _, tt := range tests {
+		addr := fakePeer(t, hash, false, func(conn net.Conn) {
+			w := &wire{rw: conn}
+			w.writeHandshake(&peer.ExtendedHandshake{M: map[string]int64{"ut_metadata": 2}, MetadataSize: tt.size})
+			w.writeMessage(localID, tt.reply, tt.data)
+			w.read()
+		})
+		conn, _ := dial(t, addr, hash)
+		_, err := Fetch(context.Background(), conn, hash)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: Fetch = %v, want error containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFetch_Cancel(t *testing.T) {
+	_, hash := testInfo(t, 100)
+	done := make(chan struct{})
+	addr := fakePeer(t, hash, false, func(conn net.Conn) { <-done })
+	defer close(done)
+	conn, _ := dial(t, addr, hash)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := Fetch(ctx, conn, hash); err != context.Canceled {
+		t.Errorf("Fetch = %v, want context.Canceled", err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	info, hash := testInfo(t, PieceSize+1000)
+	client, server := net.Pipe()
+	defer client.Close()
+	errc := make(chan error, 1)
+	go func() { errc <- Serve(context.Background(), server, info) }()
+
+	w := &wire{rw: client}
+	extID, payload, err := w.read()
+	if err != nil || extID != peer.ExtendedHandshakeID {
+		t.Fatalf("read handshake: %d %v", extID, err)
+	}
+	h, err := peer.DecodeExtendedHandshake(payload)
+	if err != nil || h.MetadataSize != int64(len(info)) || h.M[Name] != localID {
+		t.Fatalf("handshake = %+v, %v", h, err)
+	}
+	if err := w.writeHandshake(&peer.ExtendedHandshake{M: map[string]int64{"ut_metadata": 7}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		piece    int64
+		wantType int64
+		wantData []byte
+	}{
+		{1, msgData, info[PieceSize:]},
+		{0, msgData, info[:PieceSize]},
+		{2, msgReject, nil},
+		{-1, msgReject, nil},
+	} {
+		if err := w.writeMessage(localID, message{Type: msgRequest, Piece: tt.piece}, nil); err != nil {
+			t.Fatal(err)
+		}
+		extID, payload, err := w.read()
+		if err != nil || extID != 7 {
+			t.Fatalf("piece %d: read = %d, %v", tt.piece, extID, err)
+		}
+		m, data, err := decodeMessage(payload)
+		if err != nil || m.Type != tt.wantType || m.Piece != tt.piece || !bytes.Equal(data, tt.wantData) {
+			t.Errorf("piece %d: reply %+v with %d bytes, %v", tt.piece, m, len(data), err)
+		}
+		if m.Type == msgData && m.TotalSize != int64(len(info)) {
+			t.Errorf("piece %d: total_size = %d", tt.piece, m.TotalSize)
+		}
+	}
+	client.Close()
+	if err := <-errc; err != nil {
+		t.Errorf("Serve = %v after the peer closed", err)
+	}
+	if !Verify(info, hash) || Verify(info[1:], hash) {
+		t.Error("Verify")
+	}
+}
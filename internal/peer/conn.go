@@ -0,0 +1,347 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/harioms1522/BitSwift/internal/bitfield"
+)
+
+const (
+	DefaultKeepAlive    = 2 * time.Minute // send a keep-alive after this long without writing
+	DefaultIdleTimeout  = 3 * time.Minute // close the connection after this long without a message
+	DefaultWriteTimeout = 30 * time.Second
+	sendQueueLen        = 64
+)
+
+var (
+	ErrConnClosed         = errors.New("peer connection closed")
+	ErrUnexpectedBitfield = errors.New("bitfield message after the first message")
+)
+
+// ConnConfig configures a Conn. Zero durations select the defaults.
+type ConnConfig struct {
+	PieceCount     int // pieces in the torrent; 0 if unknown, in which case the peer's pieces are not tracked
+	MaxMessageSize int // see MessageLimits; 0 means DefaultMaxMessageSize
+	KeepAlive      time.Duration
+	IdleTimeout    time.Duration
+	WriteTimeout   time.Duration
+}
+
+// State is the choke and interest state of both sides of a connection.
+type State struct {
+	AmChoking      bool // we choke the peer
+	AmInterested   bool // we want pieces from the peer
+	PeerChoking    bool // the peer chokes us
+	PeerInterested bool // the peer wants pieces from us
+}
+
+// Request identifies a block requested from a peer.
+type Request struct {
+	Index, Begin, Length uint32
+}
+
+// Conn is an open connection to a peer after the handshake. A reader goroutine decodes
+// messages, updates the connection state and delivers them on Messages; a writer goroutine
+// sends queued messages and keep-alives. The connection closes when ctx is done, Close is
+// called, or either side fails.
+type Conn struct {
+	conn   net.Conn
+	remote *Handshake
+	cfg    ConnConfig
+
+	mu       sync.Mutex
+	state    State
+	have     *bitfield.Bitfield // the peer's pieces; nil if PieceCount is 0
+	inFlight map[Request]struct{}
+	received int // core BEP 3 messages received, to allow a bitfield only first
+
+	in   chan *Message
+	out  chan *Message
+	done chan struct{}
+
+	closeOnce sync.Once
+	err       error
+}
+
+// NewConn takes over conn, on which the handshake with the peer has completed (remote is
+// the peer's handshake), and starts its reader and writer goroutines. Both sides start
+// choked and not interested.
+func NewConn(ctx context.Context, conn net.Conn, remote *Handshake, cfg ConnConfig) *Conn {
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = DefaultKeepAlive
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = DefaultWriteTimeout
+	}
+	c := &Conn{
+		conn:     conn,
+		remote:   remote,
+		cfg:      cfg,
+		state:    State{AmChoking: true, PeerChoking: true},
+		inFlight: make(map[Request]struct{}),
+		in:       make(chan *Message),
+		out:      make(chan *Message, sendQueueLen),
+		done:     make(chan struct{}),
+	}
+	if cfg.PieceCount > 0 {
+		c.have = bitfield.New(cfg.PieceCount)
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.closeWith(ctx.Err())
+		case <-c.done:
+		}
+	}()
+	go c.readLoop()
+	go c.writeLoop()
+	return c
+}
+
+// Remote returns the peer's handshake.
+func (c *Conn) Remote() *Handshake {
+	return c.remote
+}
+
+// RemoteAddr returns the peer's network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Messages returns the messages received from the peer, keep-alives excluded, in order.
+// The connection state already reflects a message when it is delivered. The channel is
+// closed when the connection closes; the reader waits while nobody receives.
+func (c *Conn) Messages() <-chan *Message {
+	return c.in
+}
+
+// Done is closed when the connection has closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection closed, or nil while it is open. It is ErrConnClosed
+// after Close, and the context's error after cancellation.
+func (c *Conn) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	c.closeWith(ErrConnClosed)
+	return nil
+}
+
+func (c *Conn) closeWith(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// State returns the current choke and interest state.
+func (c *Conn) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// Bitfield returns a copy of the pieces the peer has announced, or nil if the connection
+// does not track pieces.
+func (c *Conn) Bitfield() *bitfield.Bitfield {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.have == nil {
+		return nil
+	}
+	return c.have.Clone()
+}
+
+// InFlight returns the number of our requests the peer has not answered.
+func (c *Conn) InFlight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.inFlight)
+}
+
+// Send queues m for the writer goroutine and updates our side of the state for choke,
+// unchoke, interested, not interested, request and cancel messages. It blocks while the
+// queue is full and fails once the connection has closed.
+func (c *Conn) Send(m *Message) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	if m != nil {
+		c.mu.Lock()
+		switch m.ID {
+		case MsgChoke:
+			c.state.AmChoking = true
+		case MsgUnchoke:
+			c.state.AmChoking = false
+		case MsgInterested:
+			c.state.AmInterested = true
+		case MsgNotInterested:
+			c.state.AmInterested = false
+		case MsgRequest:
+			c.inFlight[Request{m.Index, m.Begin, m.Length}] = struct{}{}
+		case MsgCancel:
+			delete(c.inFlight, Request{m.Index, m.Begin, m.Length})
+		}
+		c.mu.Unlock()
+	}
+	select {
+	case c.out <- m:
+		return nil
+	case <-c.done:
+		return c.err
+	}
+}
+
+// Interested tells the peer we want its pieces.
+func (c *Conn) Interested() error {
+	return c.Send(&Message{ID: MsgInterested})
+}
+
+// NotInterested tells the peer we no longer want its pieces.
+func (c *Conn) NotInterested() error {
+	return c.Send(&Message{ID: MsgNotInterested})
+}
+
+// Choke stops serving the peer's requests.
+func (c *Conn) Choke() error {
+	return c.Send(&Message{ID: MsgChoke})
+}
+
+// Unchoke allows the peer to request pieces.
+func (c *Conn) Unchoke() error {
+	return c.Send(&Message{ID: MsgUnchoke})
+}
+
+// Have announces that we completed piece index.
+func (c *Conn) Have(index int) error {
+	return c.Send(&Message{ID: MsgHave, Index: uint32(index)})
+}
+
+// Request asks the peer for a block and records it as in flight.
+func (c *Conn) Request(r Request) error {
+	return c.Send(&Message{ID: MsgRequest, Index: r.Index, Begin: r.Begin, Length: r.Length})
+}
+
+// Cancel withdraws a request.
+func (c *Conn) Cancel(r Request) error {
+	return c.Send(&Message{ID: MsgCancel, Index: r.Index, Begin: r.Begin, Length: r.Length})
+}
+
+func (c *Conn) readLoop() {
+	defer close(c.in)
+	limits := MessageLimits{MaxSize: c.cfg.MaxMessageSize, PieceCount: c.cfg.PieceCount}
+	for {
+		if err := c.conn.SetReadDeadline(time.Now().Add(c.cfg.IdleTimeout)); err != nil {
+			c.closeWith(err)
+			return
+		}
+		m, err := ReadMessage(c.conn, limits)
+		if err == nil {
+			err = c.update(m)
+		}
+		if err != nil {
+			c.closeWith(err)
+			return
+		}
+		if m == nil {
+			continue
+		}
+		select {
+		case c.in <- m:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// update applies a received message to the connection state.
+func (c *Conn) update(m *Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m == nil {
+		return nil
+	}
+	// Extension messages, such as a BEP 10 handshake sent before the bitfield, do not count.
+	if m.ID <= MsgCancel {
+		c.received++
+	}
+	switch m.ID {
+	case MsgChoke:
+		// Without the fast extension, a choke discards every pending request.
+		c.state.PeerChoking = true
+		clear(c.inFlight)
+	case MsgUnchoke:
+		c.state.PeerChoking = false
+	case MsgInterested:
+		c.state.PeerInterested = true
+	case MsgNotInterested:
+		c.state.PeerInterested = false
+	case MsgHave:
+		if c.have != nil {
+			c.have.Set(int(m.Index))
+		}
+	case MsgBitfield:
+		if c.received != 1 {
+			return ErrUnexpectedBitfield
+		}
+		if c.have != nil {
+			bf, err := bitfield.FromBytes(m.Payload, c.cfg.PieceCount)
+			if err != nil {
+				return fmt.Errorf("peer bitfield: %w", err)
+			}
+			c.have = bf
+		}
+	case MsgPiece:
+		delete(c.inFlight, Request{m.Index, m.Begin, uint32(len(m.Payload))})
+	}
+	return nil
+}
+
+func (c *Conn) writeLoop() {
+	keepAlive := time.NewTimer(c.cfg.KeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var m *Message
+		select {
+		case m = <-c.out:
+			if !keepAlive.Stop() {
+				select {
+				case <-keepAlive.C:
+				default:
+				}
+			}
+		case <-keepAlive.C:
+			// m is nil: a keep-alive
+		case <-c.done:
+			return
+		}
+		if err := c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteTimeout)); err != nil {
+			c.closeWith(err)
+			return
+		}
+		if err := WriteMessage(c.conn, m); err != nil {
+			c.closeWith(err)
+			return
+		}
+		keepAlive.Reset(c.cfg.KeepAlive)
+	}
+}
@@ -0,0 +1,222 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/harioms1522/BitSwift/internal/bitfield"
+)
+
+// testConn returns a Conn over an in-memory pipe and the peer's end of the pipe.
+func testConn(t *testing.T, ctx context.Context, cfg ConnConfig) (*Conn, net.Conn) {
+	t.Helper()
+	local, remote := net.Pipe()
+	c := NewConn(ctx, local, &Handshake{PeerID: [20]byte{'p'}}, cfg)
+	t.Cleanup(func() {
+		c.Close()
+		remote.Close()
+	})
+	return c, remote
+}
+
+// receive returns the next message the Conn delivers.
+func receive(t *testing.T, c *Conn) *Message {
+	t.Helper()
+	select {
+	case m, ok := <-c.Messages():
+		if !ok {
+			t.Fatalf("Messages closed: %v", c.Err())
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a message")
+	}
+	return nil
+}
+
+// send writes messages from the peer's side. The pipe is synchronous, so the writes run
+// in the background while the test receives.
+func send(remote net.Conn, msgs ...*Message) {
+	go func() {
+		for _, m := range msgs {
+			if WriteMessage(remote, m) != nil {
+				return
+			}
+		}
+	}()
+}
+
+// waitDone waits for the Conn to close and returns its error.
+func waitDone(t *testing.T, c *Conn) error {
+	t.Helper()
+	select {
+	case <-c.Done():
+		return c.Err()
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection did not close")
+		return nil
+	}
+}
+
+func TestConn_RemoteState(t *testing.T) {
+	c, remote := testConn(t, context.Background(), ConnConfig{PieceCount: 12})
+	if got, want := c.State(), (State{AmChoking: true, PeerChoking: true}); got != want {
+		t.Errorf("initial State = %+v, want %+v", got, want)
+	}
+	if c.Remote().PeerID[0] != 'p' || c.Bitfield().Count() != 0 {
+		t.Error("initial Remote or Bitfield")
+	}
+
+	send(remote, &Message{ID: MsgBitfield, Payload: []byte{0xa0, 0x10}}, nil, &Message{ID: MsgUnchoke})
+	if m := receive(t, c); m.ID != MsgBitfield {
+		t.Fatalf("first message = %v", m)
+	}
+	if got := c.Bitfield().String(); got != "101000000001" {
+		t.Errorf("Bitfield = %s", got)
+	}
+	// The keep-alive is not delivered.
+	if m := receive(t, c); m.ID != MsgUnchoke || c.State().PeerChoking {
+		t.Errorf("after unchoke: %v, %+v", m, c.State())
+	}
+
+	send(remote, &Message{ID: MsgHave, Index: 1}, &Message{ID: MsgInterested})
+	receive(t, c)
+	if !c.Bitfield().Has(1) {
+		t.Error("have not applied")
+	}
+	receive(t, c)
+	if !c.State().PeerInterested {
+		t.Error("interested not applied")
+	}
+	send(remote, &Message{ID: MsgNotInterested})
+	receive(t, c)
+	if c.State().PeerInterested {
+		t.Error("not interested not applied")
+	}
+}
+
+func TestConn_Requests(t *testing.T) {
+	c, remote := testConn(t, context.Background(), ConnConfig{PieceCount: 4})
+	r1 := Request{Index: 0, Begin: 0, Length: 4}
+	r2 := Request{Index: 0, Begin: 4, Length: 4}
+	r3 := Request{Index: 1, Begin: 0, Length: 4}
+	for _, err := range []error{c.Interested(), c.Unchoke(), c.Request(r1), c.Request(r2), c.Request(r3), c.Cancel(r3), c.Have(2)} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := c.State(); !s.AmInterested || s.AmChoking {
+		t.Errorf("State after sending = %+v", s)
+	}
+	if c.InFlight() != 2 {
+		t.Errorf("InFlight = %d, want 2", c.InFlight())
+	}
+	want := []MessageID{MsgInterested, MsgUnchoke, MsgRequest, MsgRequest, MsgRequest, MsgCancel, MsgHave}
+	for _, id := range want {
+		m, err := ReadMessage(remote, MessageLimits{})
+		if err != nil || m.ID != id {
+			t.Fatalf("peer read %v, %v; want %v", m, err, id)
+		}
+	}
+
+	send(remote, &Message{ID: MsgPiece, Index: 0, Begin: 0, Payload: []byte("abcd")})
+	if m := receive(t, c); m.ID != MsgPiece || string(m.Payload) != "abcd" {
+		t.Errorf("received %v", m)
+	}
+	if c.InFlight() != 1 {
+		t.Errorf("InFlight after piece = %d, want 1", c.InFlight())
+	}
+	// A choke discards the remaining request.
+	send(remote, &Message{ID: MsgChoke})
+	receive(t, c)
+	if c.InFlight() != 0 || !c.State().PeerChoking {
+		t.Errorf("after choke: InFlight %d, State %+v", c.InFlight(), c.State())
+	}
+}
+
+func TestConn_KeepAlive(t *testing.T) {
+	_, remote := testConn(t, context.Background(), ConnConfig{KeepAlive: 20 * time.Millisecond})
+	remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 2; i++ {
+		m, err := ReadMessage(remote, MessageLimits{})
+		if err != nil || m != nil {
+			t.Fatalf("read %v, %v; want a keep-alive", m, err)
+		}
+	}
+}
+
+func TestConn_IdleTimeout(t *testing.T) {
+	c, remote := testConn(t, context.Background(), ConnConfig{IdleTimeout: 30 * time.Millisecond, KeepAlive: time.Hour})
+	go func() {
+		// Drain what we write so only the read side can time out.
+		ReadMessage(remote, MessageLimits{})
+	}()
+	var ne net.Error
+	if err := waitDone(t, c); !errors.As(err, &ne) || !ne.Timeout() {
+		t.Errorf("Err = %v, want a timeout", err)
+	}
+	if _, ok := <-c.Messages(); ok {
+		t.Error("Messages not closed")
+	}
+}
+
+func TestConn_Shutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c, _ := testConn(t, ctx, ConnConfig{})
+	if c.Err() != nil {
+		t.Fatalf("Err while open = %v", c.Err())
+	}
+	cancel()
+	if err := waitDone(t, c); err != context.Canceled {
+		t.Errorf("Err after cancel = %v", err)
+	}
+	if err := c.Interested(); err != context.Canceled {
+		t.Errorf("Send after cancel = %v", err)
+	}
+
+	c2, _ := testConn(t, context.Background(), ConnConfig{})
+	c2.Close()
+	if err := waitDone(t, c2); err != ErrConnClosed {
+		t.Errorf("Err after Close = %v", err)
+	}
+}
+
+func TestConn_ExtendedHandshakeBeforeBitfield(t *testing.T) {
+	c, remote := testConn(t, context.Background(), ConnConfig{PieceCount: 4})
+	send(remote, &Message{ID: MsgExtended, ExtendedID: 0, Payload: []byte("de")}, &Message{ID: MsgBitfield, Payload: []byte{0x90}})
+	if m := receive(t, c); m.ID != MsgExtended {
+		t.Fatalf("first message = %v", m)
+	}
+	if m := receive(t, c); m.ID != MsgBitfield {
+		t.Fatalf("second message = %v", m)
+	}
+	if got := c.Bitfield().String(); got != "1001" {
+		t.Errorf("Bitfield = %s", got)
+	}
+}
+
+func TestConn_ProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		msgs []*Message
+		want error
+	}{
+		{"spare bits", []*Message{{ID: MsgBitfield, Payload: []byte{0xff}}}, bitfield.ErrSpareBits},
+		{"late bitfield", []*Message{{ID: MsgUnchoke}, {ID: MsgBitfield, Payload: []byte{0x80}}}, ErrUnexpectedBitfield},
+		{"piece index", []*Message{{ID: MsgHave, Index: 5}}, ErrPieceIndex},
+	}
+	for _, tt := range tests {
+		c, remote := testConn(t, context.Background(), ConnConfig{PieceCount: 5})
+		send(remote, tt.msgs...)
+		go func() {
+			for range c.Messages() {
+			}
+		}()
+		if err := waitDone(t, c); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package peer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/harioms1522/BitSwift/internal/bencode"
+)
+
+// Flag is a capability advertised in the reserved bytes of the handshake: the index of
+// the byte in the high 8 bits and the bit mask in the low 8 bits.
+type Flag uint16
+
+const (
+	ExtensionProtocol Flag = 5<<8 | 0x10 // BEP 10 extension protocol
+	FastExtension     Flag = 7<<8 | 0x04 // BEP 6 fast extension
+	DHT               Flag = 7<<8 | 0x01 // BEP 5 DHT port message
+)
+
+func (f Flag) String() string {
+	switch f {
+	case ExtensionProtocol:
+		return "extension protocol"
+	case FastExtension:
+		return "fast extension"
+	case DHT:
+		return "DHT"
+	}
+	return fmt.Sprintf("Flag(%d, %#02x)", f>>8, byte(f))
+}
+
+// Set advertises f in the handshake.
+func (h *Handshake) Set(f Flag) {
+	h.Reserved[f>>8] |= byte(f)
+}
+
+// Has reports whether the handshake advertises f.
+func (h *Handshake) Has(f Flag) bool {
+	return h.Reserved[f>>8]&byte(f) != 0
+}
+
+// ExtendedHandshakeID is the extended message ID of the extension handshake.
+const ExtendedHandshakeID = 0
+
+// ExtendedHandshake is the first extension protocol message each side sends (BEP 10).
+// All fields are optional.
+type ExtendedHandshake struct {
+	M            map[string]int64 `bencode:"m"`                       // extension name to the message ID the sender expects; 0 disables
+	V            string           `bencode:"v,omitempty"`             // client name and version
+	P            int64            `bencode:"p,omitempty"`             // the sender's listen port
+	Reqq         int64            `bencode:"reqq,omitempty"`          // requests the sender queues without dropping
+	YourIP       net.IP           `bencode:"yourip,omitempty"`        // the receiver's address as the sender sees it, 4 or 16 bytes
+	MetadataSize int64            `bencode:"metadata_size,omitempty"` // ut_metadata: size of the info dictionary
+}
+
+// handshakeOptions bound what a peer can make us allocate for its extension handshake.
+var handshakeOptions = bencode.DecoderOptions{MaxDepth: 3, MaxListLen: 256, MaxTotalAllocs: 1024}
+
+// Encode returns the bencoded payload of the handshake.
+func (h *ExtendedHandshake) Encode() ([]byte, error) {
+	hs := *h
+	if hs.M == nil {
+		hs.M = map[string]int64{} // "m" is always sent
+	}
+	if ip4 := hs.YourIP.To4(); ip4 != nil {
+		hs.YourIP = ip4
+	}
+	return bencode.Marshal(&hs)
+}
+
+// DecodeExtendedHandshake parses the payload of an extension handshake.
+func DecodeExtendedHandshake(payload []byte) (*ExtendedHandshake, error) {
+	var h ExtendedHandshake
+	if err := bencode.UnmarshalWithOptions(payload, &h, handshakeOptions); err != nil {
+		return nil, fmt.Errorf("invalid extension handshake: %w", err)
+	}
+	if len(h.YourIP) != net.IPv4len && len(h.YourIP) != net.IPv6len {
+		h.YourIP = nil
+	}
+	return &h, nil
+}
+
+// ExtensionHandler handles the payload of one extended message sent to us.
+type ExtensionHandler func(payload []byte) error
+
+// Extensions is the registry of extensions on one connection. Each registered extension
+// gets the message ID peers must use to reach it; the peer's extension handshake says
+// which IDs to use for messages to the peer.
+type Extensions struct {
+	names    []string // registered names; names[i] has local ID i+1
+	handlers []ExtensionHandler
+	remote   *ExtendedHandshake
+}
+
+// Register adds an extension named name, such as "ut_metadata" or "ut_pex", whose
+// messages are passed to h, and returns its local message ID.
+func (e *Extensions) Register(name string, h ExtensionHandler) (byte, error) {
+	if name == "" {
+		return 0, errors.New("empty extension name")
+	}
+	if e.LocalID(name) != 0 {
+		return 0, fmt.Errorf("extension %s already registered", name)
+	}
+	if len(e.names) == 255 {
+		return 0, errors.New("too many extensions")
+	}
+	e.names = append(e.names, name)
+	e.handlers = append(e.handlers, h)
+	return byte(len(e.names)), nil
+}
+
+// LocalID returns the message ID of the registered extension name, or 0.
+func (e *Extensions) LocalID(name string) byte {
+	for i, n := range e.names {
+		if n == name {
+			return byte(i + 1)
+		}
+	}
+	return 0
+}
+
+// Handshake returns our extension handshake, listing every registered extension. The
+// caller may fill in the other fields before sending it.
+func (e *Extensions) Handshake() *ExtendedHandshake {
+	h := &ExtendedHandshake{M: make(map[string]int64, len(e.names))}
+	for i, n := range e.names {
+		h.M[n] = int64(i + 1)
+	}
+	return h
+}
+
+// Remote returns the peer's extension handshake, or nil if it has not arrived.
+func (e *Extensions) Remote() *ExtendedHandshake {
+	return e.remote
+}
+
+// RemoteID returns the message ID the peer expects for extension name, and whether the
+// peer supports it.
+func (e *Extensions) RemoteID(name string) (byte, bool) {
+	if e.remote == nil {
+		return 0, false
+	}
+	id := e.remote.M[name]
+	if id <= 0 || id > 255 {
+		return 0, false
+	}
+	return byte(id), true
+}
+
+// Handle processes one extended message from the peer. A later extension handshake updates
+// the earlier one, as BEP 10 allows: it can enable or disable (ID 0) single extensions.
+// Other messages go to the handler registered under id; unknown IDs are ignored.
+func (e *Extensions) Handle(id byte, payload []byte) error {
+	if id == ExtendedHandshakeID {
+		h, err := DecodeExtendedHandshake(payload)
+		if err != nil {
+			return err
+		}
+		e.merge(h)
+		return nil
+	}
+	if int(id) > len(e.handlers) {
+		return nil
+	}
+	return e.handlers[id-1](payload)
+}
+
+func (e *Extensions) merge(h *ExtendedHandshake) {
+	if e.remote == nil {
+		e.remote = h
+		return
+	}
+	r := e.remote
+	if r.M == nil {
+		r.M = make(map[string]int64, len(h.M))
+	}
+	for name, id := range h.M {
+		r.M[name] = id
+	}
+	if h.V != "" {
+		r.V = h.V
+	}
+	if h.P != 0 {
+		r.P = h.P
+	}
+	if h.Reqq != 0 {
+		r.Reqq = h.Reqq
+	}
+	if h.YourIP != nil {
+		r.YourIP = h.YourIP
+	}
+	if h.MetadataSize != 0 {
+		r.MetadataSize = h.MetadataSize
+	}
+}
@@ -0,0 +1,145 @@
+package peer
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestHandshakeFlags(t *testing.T) {
+	h := &Handshake{}
+	for _, f := range []Flag{ExtensionProtocol, FastExtension, DHT} {
+		if h.Has(f) {
+			t.Errorf("empty handshake has %v", f)
+		}
+	}
+	h.Set(ExtensionProtocol)
+	h.Set(DHT)
+	if want := [8]byte{5: 0x10, 7: 0x01}; h.Reserved != want {
+		t.Errorf("Reserved = %x, want %x", h.Reserved, want)
+	}
+	if !h.Has(ExtensionProtocol) || !h.Has(DHT) || h.Has(FastExtension) {
+		t.Errorf("Has after Set: %v %v %v", h.Has(ExtensionProtocol), h.Has(DHT), h.Has(FastExtension))
+	}
+
+	// The flags survive the wire format.
+	decoded, err := DecodeHandshake(h.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Has(ExtensionProtocol) || !decoded.Has(DHT) {
+		t.Error("flags lost in Encode/DecodeHandshake")
+	}
+	if got := FastExtension.String(); got != "fast extension" {
+		t.Errorf("String = %q", got)
+	}
+	if got := Flag(2<<8 | 0x80).String(); got != "Flag(2, 0x80)" {
+		t.Errorf("String = %q", got)
+	}
+}
+
+func TestExtendedHandshake_EncodeDecode(t *testing.T) {
+	h := &ExtendedHandshake{
+		M:            map[string]int64{"ut_metadata": 1, "ut_pex": 2},
+		V:            "BitSwift",
+		P:            6881,
+		Reqq:         250,
+		YourIP:       net.ParseIP("192.0.2.7"),
+		MetadataSize: 31235,
+	}
+	b, err := h.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "d1:md11:ut_metadatai1e6:ut_pexi2ee13:metadata_sizei31235e1:pi6881e4:reqqi250e1:v8:BitSwift6:yourip4:\xc0\x00\x02\x07e"
+	if string(b) != want {
+		t.Errorf("Encode =\n%q\nwant\n%q", b, want)
+	}
+	got, err := DecodeExtendedHandshake(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.YourIP = h.YourIP.To4()
+	if !reflect.DeepEqual(got, h) {
+		t.Errorf("round trip = %+v, want %+v", got, h)
+	}
+
+	// "m" is sent even when empty; unknown keys and a malformed yourip are ignored.
+	if b, _ := (&ExtendedHandshake{}).Encode(); string(b) != "d1:mdee" {
+		t.Errorf("empty Encode = %q", b)
+	}
+	got, err = DecodeExtendedHandshake([]byte("d1:md6:ut_pexi0ee1:xi1e6:yourip3:abce"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.YourIP != nil || got.M["ut_pex"] != 0 {
+		t.Errorf("decoded %+v", got)
+	}
+	if _, err := DecodeExtendedHandshake([]byte("d1:mi1ee")); err == nil {
+		t.Error("DecodeExtendedHandshake accepted m as an integer")
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	var e Extensions
+	var got [][]byte
+	record := func(payload []byte) error {
+		got = append(got, payload)
+		return nil
+	}
+	errPex := errors.New("pex failed")
+	if id, err := e.Register("ut_metadata", record); err != nil || id != 1 {
+		t.Fatalf("Register = %d, %v", id, err)
+	}
+	if id, err := e.Register("ut_pex", func([]byte) error { return errPex }); err != nil || id != 2 {
+		t.Fatalf("Register = %d, %v", id, err)
+	}
+	if _, err := e.Register("ut_pex", record); err == nil {
+		t.Error("duplicate Register succeeded")
+	}
+	if _, err := e.Register("", record); err == nil {
+		t.Error("Register with an empty name succeeded")
+	}
+	if e.LocalID("ut_pex") != 2 || e.LocalID("lt_donthave") != 0 {
+		t.Errorf("LocalID = %d, %d", e.LocalID("ut_pex"), e.LocalID("lt_donthave"))
+	}
+	if hs := e.Handshake(); !reflect.DeepEqual(hs.M, map[string]int64{"ut_metadata": 1, "ut_pex": 2}) {
+		t.Errorf("Handshake().M = %v", hs.M)
+	}
+
+	// Before the peer's handshake nothing can be sent.
+	if _, ok := e.RemoteID("ut_metadata"); ok || e.Remote() != nil {
+		t.Error("RemoteID before the handshake")
+	}
+	if err := e.Handle(ExtendedHandshakeID, []byte("d1:md11:ut_metadatai3e6:ut_pexi4ee13:metadata_sizei100e1:v3:abce")); err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := e.RemoteID("ut_metadata"); !ok || id != 3 {
+		t.Errorf("RemoteID(ut_metadata) = %d, %v", id, ok)
+	}
+	// A later handshake disables ut_pex and keeps the other values.
+	if err := e.Handle(ExtendedHandshakeID, []byte("d1:md6:ut_pexi0eee")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.RemoteID("ut_pex"); ok {
+		t.Error("ut_pex still enabled")
+	}
+	if r := e.Remote(); r.M["ut_metadata"] != 3 || r.MetadataSize != 100 || r.V != "abc" {
+		t.Errorf("Remote after update = %+v", r)
+	}
+
+	if err := e.Handle(1, []byte("payload")); err != nil || len(got) != 1 || !bytes.Equal(got[0], []byte("payload")) {
+		t.Errorf("Handle(1) = %v, got %q", err, got)
+	}
+	if err := e.Handle(2, nil); err != errPex {
+		t.Errorf("Handle(2) = %v, want the handler's error", err)
+	}
+	if err := e.Handle(9, nil); err != nil {
+		t.Errorf("Handle of an unknown ID = %v", err)
+	}
+	if err := e.Handle(ExtendedHandshakeID, []byte("x")); err == nil {
+		t.Error("Handle accepted a malformed handshake")
+	}
+}
@@ -1,6 +1,7 @@
 package peer
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -57,18 +58,86 @@ func DecodeHandshake(b []byte) (*Handshake, error) {
 	return h, nil
 }
 
+// Dialer opens network connections. *net.Dialer implements it; tests and proxies can
+// supply their own.
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
 // DoHandshake connects to addr (e.g. "ip:port"), sends our handshake, and reads the peer's handshake.
 // If the peer's info_hash does not match wantInfoHash, returns ErrInfoHashMismatch.
 // Timeout applies to connect and read/write.
 func DoHandshake(addr string, our *Handshake, wantInfoHash [20]byte, timeout time.Duration) (*Handshake, error) {
-	conn, err := net.DialTimeout("tcp", addr, timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return DoHandshakeContext(ctx, nil, addr, our, wantInfoHash)
+}
+
+// DoHandshakeContext is like DoHandshake, but connects with d (a net.Dialer if nil) and
+// is bounded by ctx instead of a timeout: cancelling ctx interrupts the dial, read or
+// write in progress, and the context's error is returned.
+func DoHandshakeContext(ctx context.Context, d Dialer, addr string, our *Handshake, wantInfoHash [20]byte) (*Handshake, error) {
+	conn, their, err := DialContext(ctx, d, addr, our, wantInfoHash)
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
-	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+	conn.Close()
+	return their, nil
+}
+
+// Dial is like DoHandshake, but keeps the connection open for the messages that follow the
+// handshake. The deadline used for the handshake is cleared before Dial returns.
+func Dial(addr string, our *Handshake, wantInfoHash [20]byte, timeout time.Duration) (net.Conn, *Handshake, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return DialContext(ctx, nil, addr, our, wantInfoHash)
+}
+
+// DialContext is like DoHandshakeContext, but keeps the connection open. Once it returns,
+// ctx no longer affects the connection.
+func DialContext(ctx context.Context, d Dialer, addr string, our *Handshake, wantInfoHash [20]byte) (net.Conn, *Handshake, error) {
+	if d == nil {
+		d = &net.Dialer{}
+	}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	their, err := handshake(ctx, conn, our, wantInfoHash)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, their, nil
+}
+
+// handshake exchanges handshakes on conn until ctx is done. Cancellation or the context's
+// deadline moves the connection's deadline into the past, which fails the blocked read or
+// write; the context's error is returned instead.
+func handshake(ctx context.Context, conn net.Conn, our *Handshake, wantInfoHash [20]byte) (*Handshake, error) {
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+		close(interrupted)
+	})
+	their, err := exchange(conn, our, wantInfoHash)
+	if !stop() {
+		if err != nil {
+			return nil, ctx.Err()
+		}
+		// The exchange finished as the context ended: undo the interruption.
+		<-interrupted
+		if err := conn.SetDeadline(time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
 		return nil, err
 	}
+	return their, nil
+}
+
+func exchange(conn net.Conn, our *Handshake, wantInfoHash [20]byte) (*Handshake, error) {
 	payload := our.Encode()
 	if _, err := conn.Write(payload); err != nil {
 		return nil, err
@@ -2,7 +2,12 @@ package peer
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestHandshake_EncodeDecode(t *testing.T) {
@@ -64,3 +69,136 @@ func TestDecodeHandshake_ProtocolMismatch(t *testing.T) {
 		t.Errorf("protocol mismatch: got %v", err)
 	}
 }
+
+func TestDial(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	infoHash := [20]byte{1, 2, 3}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, HandshakeLen)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		conn.Write((&Handshake{InfoHash: infoHash, PeerID: [20]byte{'r'}}).Encode())
+		// Echo one byte to show the connection stays open after the handshake.
+		if _, err := io.ReadFull(conn, buf[:1]); err == nil {
+			conn.Write(buf[:1])
+		}
+	}()
+
+	conn, their, err := Dial(ln.Addr().String(), &Handshake{InfoHash: infoHash}, infoHash, time.Second)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	if their.PeerID[0] != 'r' {
+		t.Errorf("peer id = %q", their.PeerID)
+	}
+	if _, err := conn.Write([]byte{'x'}); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(conn, b); err != nil || b[0] != 'x' {
+		t.Errorf("after handshake: read %q, %v", b, err)
+	}
+
+	// Nobody answers the second connection: the handshake times out.
+	if _, _, err := Dial(ln.Addr().String(), &Handshake{}, infoHash, 100*time.Millisecond); err == nil {
+		t.Error("Dial without a handshake reply succeeded")
+	}
+}
+
+// pipeDialer connects to an in-memory peer that runs serve on its end of the pipe.
+type pipeDialer struct {
+	serve func(conn net.Conn)
+	err   error
+}
+
+func (d pipeDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	local, remote := net.Pipe()
+	go func() {
+		defer remote.Close()
+		d.serve(remote)
+	}()
+	return local, nil
+}
+
+// replyWith returns a peer that reads our handshake and answers with h, then waits for
+// us to hang up.
+func replyWith(h *Handshake) func(net.Conn) {
+	return func(conn net.Conn) {
+		if _, err := io.ReadFull(conn, make([]byte, HandshakeLen)); err != nil {
+			return
+		}
+		conn.Write(h.Encode())
+		io.Copy(io.Discard, conn)
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	infoHash := [20]byte{1, 2, 3}
+	our := &Handshake{InfoHash: infoHash}
+	silent := func(conn net.Conn) { io.Copy(io.Discard, conn) }
+	errRefused := errors.New("refused")
+
+	tests := []struct {
+		name    string
+		d       pipeDialer
+		timeout time.Duration
+		cancel  time.Duration // cancel the context after this long, if set
+		want    error
+	}{
+		{"ok", pipeDialer{serve: replyWith(&Handshake{InfoHash: infoHash})}, time.Second, 0, nil},
+		{"mismatch", pipeDialer{serve: replyWith(&Handshake{InfoHash: [20]byte{9}})}, time.Second, 0, ErrInfoHashMismatch},
+		{"dial error", pipeDialer{err: errRefused}, time.Second, 0, errRefused},
+		{"deadline", pipeDialer{serve: silent}, 50 * time.Millisecond, 0, context.DeadlineExceeded},
+		{"cancel", pipeDialer{serve: silent}, time.Minute, 50 * time.Millisecond, context.Canceled},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+		if tt.cancel > 0 {
+			time.AfterFunc(tt.cancel, cancel)
+		}
+		start := time.Now()
+		_, err := DoHandshakeContext(ctx, tt.d, "peer", our, infoHash)
+		cancel()
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("%s: took %v", tt.name, time.Since(start))
+		}
+	}
+}
+
+func TestDialContext_Detach(t *testing.T) {
+	infoHash := [20]byte{1, 2, 3}
+	d := pipeDialer{serve: func(conn net.Conn) {
+		io.ReadFull(conn, make([]byte, HandshakeLen))
+		conn.Write((&Handshake{InfoHash: infoHash}).Encode())
+		conn.Write([]byte{'x'})
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, _, err := DialContext(ctx, d, "peer", &Handshake{InfoHash: infoHash}, infoHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Cancelling the context after the handshake leaves the connection usable.
+	cancel()
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(conn, b); err != nil || b[0] != 'x' {
+		t.Errorf("read after cancel: %q, %v", b, err)
+	}
+}
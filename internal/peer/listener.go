@@ -0,0 +1,163 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHandshakeTimeout bounds how long an incoming connection may take to send its handshake.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+var (
+	ErrUnknownInfoHash = errors.New("handshake for an unknown info hash")
+	ErrSelfConnection  = errors.New("connection from our own peer id")
+)
+
+// Handler takes over an incoming connection once the handshakes are exchanged; remote is
+// the peer's handshake. It runs in its own goroutine and must close conn when done.
+type Handler func(conn net.Conn, remote *Handshake)
+
+// Listener accepts incoming peer connections. Unlike an outgoing connection, the remote
+// side sends its handshake first: the listener reads it, routes the connection to the
+// torrent registered for its info hash, and only then replies with our handshake.
+// Connections for unknown info hashes are closed without a reply.
+type Listener struct {
+	PeerID           [20]byte      // our peer id, sent in every reply
+	Reserved         [8]byte       // reserved bytes of our reply, e.g. with ExtensionProtocol set
+	HandshakeTimeout time.Duration // 0 means DefaultHandshakeTimeout
+
+	ln       net.Listener
+	mu       sync.Mutex
+	torrents map[[20]byte]Handler
+	wg       sync.WaitGroup // handshakes in progress
+}
+
+// ParsePortRange parses a port such as "6881" or a range such as "6881-6889". Port 0, on
+// its own, asks Listen for any free port.
+func ParsePortRange(s string) (first, last int, err error) {
+	a, b, isRange := strings.Cut(s, "-")
+	first, err1 := strconv.Atoi(a)
+	last = first
+	var err2 error
+	if isRange {
+		last, err2 = strconv.Atoi(b)
+	}
+	if err1 != nil || err2 != nil || first < 0 || first == 0 && isRange || last > 65535 || last < first {
+		return 0, 0, fmt.Errorf("invalid port or port range %q", s)
+	}
+	return first, last, nil
+}
+
+// Listen listens for peers on host (empty for all interfaces) at the first free port
+// from first to last.
+func Listen(host string, first, last int) (*Listener, error) {
+	var err error
+	for port := first; port <= last; port++ {
+		var ln net.Listener
+		if ln, err = net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port))); err == nil {
+			return &Listener{ln: ln, torrents: make(map[[20]byte]Handler)}, nil
+		}
+	}
+	return nil, fmt.Errorf("no free port in %d-%d: %w", first, last, err)
+}
+
+// Addr returns the listening address.
+func (l *Listener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// Port returns the listening port, to report to trackers.
+func (l *Listener) Port() int {
+	return l.ln.Addr().(*net.TCPAddr).Port
+}
+
+// Register routes connections for infoHash to h, replacing any earlier handler.
+func (l *Listener) Register(infoHash [20]byte, h Handler) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.torrents[infoHash] = h
+}
+
+// Unregister stops accepting connections for infoHash.
+func (l *Listener) Unregister(infoHash [20]byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.torrents, infoHash)
+}
+
+// Serve accepts connections until ctx is done or the listener is closed, then waits for
+// the handshakes in progress. It returns nil after a shutdown and the accept error otherwise.
+func (l *Listener) Serve(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() { l.ln.Close() })
+	defer stop()
+	defer l.wg.Wait()
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			if err := l.accept(ctx, conn); err != nil {
+				conn.Close()
+			}
+		}()
+	}
+}
+
+// Close stops the listener.
+func (l *Listener) Close() error {
+	return l.ln.Close()
+}
+
+// accept exchanges handshakes on an incoming connection and hands it to its torrent's handler.
+func (l *Listener) accept(ctx context.Context, conn net.Conn) error {
+	timeout := l.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	buf := make([]byte, HandshakeLen)
+	if _, err := readFull(conn, buf); err != nil {
+		return err
+	}
+	their, err := DecodeHandshake(buf)
+	if err != nil {
+		return err
+	}
+	if their.PeerID == l.PeerID {
+		return ErrSelfConnection
+	}
+	l.mu.Lock()
+	h, ok := l.torrents[their.InfoHash]
+	l.mu.Unlock()
+	if !ok {
+		return ErrUnknownInfoHash
+	}
+	ours := &Handshake{Reserved: l.Reserved, InfoHash: their.InfoHash, PeerID: l.PeerID}
+	if _, err := conn.Write(ours.Encode()); err != nil {
+		return err
+	}
+	if !stop() {
+		return ctx.Err()
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return err
+	}
+	go h(conn, their)
+	return nil
+}
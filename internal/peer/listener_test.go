@@ -0,0 +1,145 @@
+package peer
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		in          string
+		first, last int
+		ok          bool
+	}{
+		{"6881", 6881, 6881, true},
+		{"6881-6889", 6881, 6889, true},
+		{"1-65535", 1, 65535, true},
+		{"", 0, 0, false},
+		{"0", 0, 0, true},
+		{"0-10", 0, 0, false},
+		{"65536", 0, 0, false},
+		{"6889-6881", 0, 0, false},
+		{"6881-", 0, 0, false},
+		{"a-b", 0, 0, false},
+	}
+	for _, tt := range tests {
+		first, last, err := ParsePortRange(tt.in)
+		if (err == nil) != tt.ok || first != tt.first || last != tt.last {
+			t.Errorf("ParsePortRange(%q) = %d, %d, %v", tt.in, first, last, err)
+		}
+	}
+}
+
+// testListener starts a Listener on a loopback port and returns it with the address to dial.
+func testListener(t *testing.T, timeout time.Duration) (*Listener, string) {
+	t.Helper()
+	l, err := Listen("127.0.0.1", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.PeerID = [20]byte{'s'}
+	l.Reserved[5] = 0x10
+	l.HandshakeTimeout = timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- l.Serve(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve = %v", err)
+		}
+	})
+	return l, l.Addr().String()
+}
+
+func TestListener_Accept(t *testing.T) {
+	l, addr := testListener(t, 0)
+	hash := [20]byte{'h'}
+	accepted := make(chan *Handshake, 1)
+	l.Register(hash, func(conn net.Conn, remote *Handshake) {
+		defer conn.Close()
+		accepted <- remote
+		WriteMessage(conn, &Message{ID: MsgUnchoke})
+	})
+
+	our := &Handshake{InfoHash: hash, PeerID: [20]byte{'c'}}
+	conn, their, err := Dial(addr, our, hash, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if their.PeerID != l.PeerID || !their.Has(ExtensionProtocol) {
+		t.Errorf("reply handshake = %+v", their)
+	}
+	select {
+	case remote := <-accepted:
+		if remote.PeerID != our.PeerID || remote.InfoHash != hash {
+			t.Errorf("handler got %+v", remote)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler not called")
+	}
+	// The handler owns the connection after the handshake.
+	if m, err := ReadMessage(conn, MessageLimits{}); err != nil || m.ID != MsgUnchoke {
+		t.Errorf("read %v, %v", m, err)
+	}
+}
+
+func TestListener_Reject(t *testing.T) {
+	l, addr := testListener(t, 100*time.Millisecond)
+	l.Register([20]byte{'h'}, func(conn net.Conn, remote *Handshake) {
+		conn.Close()
+		t.Error("handler called")
+	})
+	l.Unregister([20]byte{'h'})
+
+	tests := []struct {
+		name string
+		send []byte
+	}{
+		{"unknown info hash", (&Handshake{InfoHash: [20]byte{'h'}, PeerID: [20]byte{'c'}}).Encode()},
+		{"own peer id", (&Handshake{InfoHash: [20]byte{'h'}, PeerID: l.PeerID}).Encode()},
+		{"bad protocol", make([]byte, HandshakeLen)},
+		{"no handshake", nil},
+	}
+	for _, tt := range tests {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write(tt.send); err != nil {
+			t.Fatal(err)
+		}
+		// The connection is closed without a reply.
+		if n, err := io.ReadFull(conn, make([]byte, 1)); n != 0 || err != io.EOF {
+			t.Errorf("%s: read %d bytes, %v", tt.name, n, err)
+		}
+		conn.Close()
+	}
+}
+
+func TestListen_PortRange(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	port := busy.Addr().(*net.TCPAddr).Port
+
+	l, err := Listen("127.0.0.1", port, port+20)
+	if err != nil {
+		t.Skipf("no free port after %d: %v", port, err)
+	}
+	defer l.Close()
+	if l.Port() <= port || l.Port() > port+20 {
+		t.Errorf("Port = %d, want in (%d, %d]", l.Port(), port, port+20)
+	}
+	if _, err := Listen("127.0.0.1", port, port); err == nil {
+		t.Errorf("Listen on busy port %s succeeded", strconv.Itoa(port))
+	}
+}
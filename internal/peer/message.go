@@ -0,0 +1,247 @@
+package peer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MessageID identifies a peer wire message.
+type MessageID uint8
+
+const (
+	MsgChoke         MessageID = 0
+	MsgUnchoke       MessageID = 1
+	MsgInterested    MessageID = 2
+	MsgNotInterested MessageID = 3
+	MsgHave          MessageID = 4
+	MsgBitfield      MessageID = 5
+	MsgRequest       MessageID = 6
+	MsgPiece         MessageID = 7
+	MsgCancel        MessageID = 8
+	MsgPort          MessageID = 9
+	MsgExtended      MessageID = 20 // extension protocol (BEP 10)
+)
+
+var messageNames = map[MessageID]string{
+	MsgChoke:         "choke",
+	MsgUnchoke:       "unchoke",
+	MsgInterested:    "interested",
+	MsgNotInterested: "not interested",
+	MsgHave:          "have",
+	MsgBitfield:      "bitfield",
+	MsgRequest:       "request",
+	MsgPiece:         "piece",
+	MsgCancel:        "cancel",
+	MsgPort:          "port",
+	MsgExtended:      "extended",
+}
+
+func (id MessageID) String() string {
+	if s, ok := messageNames[id]; ok {
+		return s
+	}
+	return fmt.Sprintf("MessageID(%d)", uint8(id))
+}
+
+const (
+	// DefaultMaxMessageSize is the longest message ReadMessage accepts unless limited
+	// otherwise: a piece message carrying a 128 KiB block.
+	DefaultMaxMessageSize = 9 + MaxRequestLength
+	// MaxRequestLength is the largest block a request or cancel may ask for.
+	MaxRequestLength = 128 * 1024
+)
+
+var (
+	ErrMessageTooLarge = errors.New("peer message too large")
+	ErrMalformed       = errors.New("malformed peer message")
+	ErrPieceIndex      = errors.New("peer message piece index out of range")
+)
+
+// Message is one peer wire message. A keep-alive is represented by a nil *Message.
+type Message struct {
+	ID         MessageID
+	Index      uint32 // have, request, piece, cancel: piece index
+	Begin      uint32 // request, piece, cancel: byte offset within the piece
+	Length     uint32 // request, cancel: block length
+	Port       uint16 // port: the peer's DHT port
+	ExtendedID byte   // extended: the extension's message ID
+	// Payload is the bitfield of a bitfield message, the block of a piece message, the
+	// bencoded payload (and any trailing data) of an extended message, and the raw payload
+	// of a message with an unknown ID.
+	Payload []byte
+}
+
+// MessageLimits bound the messages ReadMessage accepts.
+type MessageLimits struct {
+	MaxSize    int // largest message length, not counting the length prefix; 0 means DefaultMaxMessageSize
+	PieceCount int // if positive, piece indexes must be below it and a bitfield must have exactly this many bits
+}
+
+func (m *Message) String() string {
+	if m == nil {
+		return "keep-alive"
+	}
+	switch m.ID {
+	case MsgHave:
+		return fmt.Sprintf("have %d", m.Index)
+	case MsgRequest, MsgCancel:
+		return fmt.Sprintf("%v %d+%d:%d", m.ID, m.Index, m.Begin, m.Length)
+	case MsgPiece:
+		return fmt.Sprintf("piece %d+%d:%d", m.Index, m.Begin, len(m.Payload))
+	case MsgPort:
+		return fmt.Sprintf("port %d", m.Port)
+	case MsgBitfield:
+		return fmt.Sprintf("bitfield of %d bytes", len(m.Payload))
+	case MsgExtended:
+		return fmt.Sprintf("extended %d of %d bytes", m.ExtendedID, len(m.Payload))
+	}
+	return m.ID.String()
+}
+
+// Encode serializes the message to the wire format: a 4-byte big-endian length, the ID
+// and the payload. A nil message encodes as a keep-alive.
+func (m *Message) Encode() []byte {
+	if m == nil {
+		return make([]byte, 4)
+	}
+	var b []byte
+	switch m.ID {
+	case MsgHave:
+		b = binary.BigEndian.AppendUint32(header(m.ID, 4), m.Index)
+	case MsgRequest, MsgCancel:
+		b = header(m.ID, 12)
+		b = binary.BigEndian.AppendUint32(b, m.Index)
+		b = binary.BigEndian.AppendUint32(b, m.Begin)
+		b = binary.BigEndian.AppendUint32(b, m.Length)
+	case MsgPiece:
+		b = header(m.ID, 8+len(m.Payload))
+		b = binary.BigEndian.AppendUint32(b, m.Index)
+		b = binary.BigEndian.AppendUint32(b, m.Begin)
+		b = append(b, m.Payload...)
+	case MsgPort:
+		b = binary.BigEndian.AppendUint16(header(m.ID, 2), m.Port)
+	case MsgExtended:
+		b = append(header(m.ID, 1+len(m.Payload)), m.ExtendedID)
+		b = append(b, m.Payload...)
+	case MsgChoke, MsgUnchoke, MsgInterested, MsgNotInterested:
+		b = header(m.ID, 0)
+	default:
+		b = append(header(m.ID, len(m.Payload)), m.Payload...)
+	}
+	return b
+}
+
+// header starts a message with payloadLen bytes after the ID.
+func header(id MessageID, payloadLen int) []byte {
+	b := make([]byte, 5, 5+payloadLen)
+	binary.BigEndian.PutUint32(b, uint32(1+payloadLen))
+	b[4] = byte(id)
+	return b
+}
+
+// WriteMessage writes m, or a keep-alive if m is nil, to w.
+func WriteMessage(w io.Writer, m *Message) error {
+	_, err := w.Write(m.Encode())
+	return err
+}
+
+// ReadMessage reads one message from r. It returns nil, nil for a keep-alive. The length
+// prefix is checked against limits before the message is read, so a peer cannot make us
+// allocate more than limits.MaxSize bytes; an error other than io.EOF leaves r in the
+// middle of a message, and the connection should be closed.
+func ReadMessage(r io.Reader, limits MessageLimits) (*Message, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(prefix[:])
+	if n == 0 {
+		return nil, nil
+	}
+	maxSize := limits.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxMessageSize
+	}
+	if uint64(n) > uint64(maxSize) {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrMessageTooLarge, n, maxSize)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return DecodeMessage(b, limits)
+}
+
+// DecodeMessage parses a message without its length prefix: the ID followed by the
+// payload. The returned Payload aliases b.
+func DecodeMessage(b []byte, limits MessageLimits) (*Message, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	m := &Message{ID: MessageID(b[0])}
+	p := b[1:]
+	want := -1 // exact payload length, if fixed
+	switch m.ID {
+	case MsgChoke, MsgUnchoke, MsgInterested, MsgNotInterested:
+		want = 0
+	case MsgHave:
+		want = 4
+	case MsgRequest, MsgCancel:
+		want = 12
+	case MsgPort:
+		want = 2
+	case MsgPiece:
+		if len(p) < 8 {
+			return nil, fmt.Errorf("%w: %v with %d-byte payload", ErrMalformed, m.ID, len(p))
+		}
+	case MsgExtended:
+		if len(p) < 1 {
+			return nil, fmt.Errorf("%w: empty extended message", ErrMalformed)
+		}
+	}
+	if want >= 0 && len(p) != want {
+		return nil, fmt.Errorf("%w: %v with %d-byte payload, want %d", ErrMalformed, m.ID, len(p), want)
+	}
+
+	switch m.ID {
+	case MsgHave:
+		m.Index = binary.BigEndian.Uint32(p)
+	case MsgRequest, MsgCancel:
+		m.Index = binary.BigEndian.Uint32(p)
+		m.Begin = binary.BigEndian.Uint32(p[4:])
+		m.Length = binary.BigEndian.Uint32(p[8:])
+		if m.Length == 0 || m.Length > MaxRequestLength {
+			return nil, fmt.Errorf("%w: %v of %d bytes", ErrMalformed, m.ID, m.Length)
+		}
+	case MsgPiece:
+		m.Index = binary.BigEndian.Uint32(p)
+		m.Begin = binary.BigEndian.Uint32(p[4:])
+		m.Payload = p[8:]
+	case MsgPort:
+		m.Port = binary.BigEndian.Uint16(p)
+	case MsgBitfield:
+		if limits.PieceCount > 0 && len(p) != (limits.PieceCount+7)/8 {
+			return nil, fmt.Errorf("%w: bitfield of %d bytes for %d pieces", ErrMalformed, len(p), limits.PieceCount)
+		}
+		m.Payload = p
+	case MsgExtended:
+		m.ExtendedID = p[0]
+		m.Payload = p[1:]
+	case MsgChoke, MsgUnchoke, MsgInterested, MsgNotInterested:
+	default:
+		m.Payload = p
+	}
+
+	switch m.ID {
+	case MsgHave, MsgRequest, MsgPiece, MsgCancel:
+		if limits.PieceCount > 0 && uint64(m.Index) >= uint64(limits.PieceCount) {
+			return nil, fmt.Errorf("%w: %v for piece %d of %d", ErrPieceIndex, m.ID, m.Index, limits.PieceCount)
+		}
+	}
+	return m, nil
+}
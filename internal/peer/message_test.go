@@ -0,0 +1,127 @@
+package peer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMessage_RoundTrip(t *testing.T) {
+	tests := []struct {
+		msg  *Message
+		wire string
+	}{
+		{nil, "\x00\x00\x00\x00"},
+		{&Message{ID: MsgChoke}, "\x00\x00\x00\x01\x00"},
+		{&Message{ID: MsgUnchoke}, "\x00\x00\x00\x01\x01"},
+		{&Message{ID: MsgInterested}, "\x00\x00\x00\x01\x02"},
+		{&Message{ID: MsgNotInterested}, "\x00\x00\x00\x01\x03"},
+		{&Message{ID: MsgHave, Index: 7}, "\x00\x00\x00\x05\x04\x00\x00\x00\x07"},
+		{&Message{ID: MsgBitfield, Payload: []byte{0xff, 0x80}}, "\x00\x00\x00\x03\x05\xff\x80"},
+		{&Message{ID: MsgRequest, Index: 1, Begin: 0x4000, Length: 0x4000},
+			"\x00\x00\x00\x0d\x06\x00\x00\x00\x01\x00\x00\x40\x00\x00\x00\x40\x00"},
+		{&Message{ID: MsgPiece, Index: 2, Begin: 16, Payload: []byte("data")},
+			"\x00\x00\x00\x0d\x07\x00\x00\x00\x02\x00\x00\x00\x10data"},
+		{&Message{ID: MsgCancel, Index: 1, Begin: 0, Length: 1},
+			"\x00\x00\x00\x0d\x08\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x01"},
+		{&Message{ID: MsgPort, Port: 6881}, "\x00\x00\x00\x03\x09\x1a\xe1"},
+		{&Message{ID: MsgExtended, ExtendedID: 3, Payload: []byte("de")}, "\x00\x00\x00\x04\x14\x03de"},
+		{&Message{ID: 13, Payload: []byte{0, 0, 0, 7}}, "\x00\x00\x00\x05\x0d\x00\x00\x00\x07"}, // suggest piece (BEP 6)
+	}
+	var stream bytes.Buffer
+	for _, tt := range tests {
+		if got := string(tt.msg.Encode()); got != tt.wire {
+			t.Errorf("%v: Encode = %q, want %q", tt.msg, got, tt.wire)
+		}
+		if err := WriteMessage(&stream, tt.msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range tests {
+		got, err := ReadMessage(&stream, MessageLimits{PieceCount: 10})
+		if err != nil {
+			t.Fatalf("%v: ReadMessage: %v", tt.msg, err)
+		}
+		if !reflect.DeepEqual(got, tt.msg) {
+			t.Errorf("ReadMessage = %#v, want %#v", got, tt.msg)
+		}
+	}
+	if _, err := ReadMessage(&stream, MessageLimits{}); err != io.EOF {
+		t.Errorf("ReadMessage at end = %v, want io.EOF", err)
+	}
+}
+
+func TestReadMessage_Malformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		wire   string
+		limits MessageLimits
+		want   error
+	}{
+		{"too large", "\x00\x02\x00\x0a\x07", MessageLimits{}, ErrMessageTooLarge},
+		{"over limit", "\x00\x00\x00\x06\x05\x00\x00\x00\x00\x00", MessageLimits{MaxSize: 5}, ErrMessageTooLarge},
+		{"huge prefix", "\xff\xff\xff\xff", MessageLimits{}, ErrMessageTooLarge},
+		{"choke with payload", "\x00\x00\x00\x02\x00\x00", MessageLimits{}, ErrMalformed},
+		{"short have", "\x00\x00\x00\x04\x04\x00\x00\x00", MessageLimits{}, ErrMalformed},
+		{"long request", "\x00\x00\x00\x0e\x06" + strings.Repeat("\x00", 13), MessageLimits{}, ErrMalformed},
+		{"zero-length request", "\x00\x00\x00\x0d\x06" + strings.Repeat("\x00", 12), MessageLimits{}, ErrMalformed},
+		{"huge request", "\x00\x00\x00\x0d\x06\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x01", MessageLimits{}, ErrMalformed},
+		{"short piece", "\x00\x00\x00\x05\x07\x00\x00\x00\x01", MessageLimits{}, ErrMalformed},
+		{"short port", "\x00\x00\x00\x02\x09\x01", MessageLimits{}, ErrMalformed},
+		{"empty extended", "\x00\x00\x00\x01\x14", MessageLimits{}, ErrMalformed},
+		{"bitfield too short", "\x00\x00\x00\x02\x05\xff", MessageLimits{PieceCount: 9}, ErrMalformed},
+		{"bitfield too long", "\x00\x00\x00\x03\x05\xff\x00", MessageLimits{PieceCount: 8}, ErrMalformed},
+		{"have out of range", "\x00\x00\x00\x05\x04\x00\x00\x00\x0a", MessageLimits{PieceCount: 10}, ErrPieceIndex},
+		{"piece out of range", "\x00\x00\x00\x09\x07\x00\x00\x01\x00\x00\x00\x00\x00", MessageLimits{PieceCount: 10}, ErrPieceIndex},
+		{"cancel out of range", "\x00\x00\x00\x0d\x08\xff\xff\xff\xff\x00\x00\x00\x00\x00\x00\x00\x01", MessageLimits{PieceCount: 10}, ErrPieceIndex},
+		{"truncated prefix", "\x00\x00", MessageLimits{}, io.ErrUnexpectedEOF},
+		{"truncated payload", "\x00\x00\x00\x05\x04\x00", MessageLimits{}, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		_, err := ReadMessage(strings.NewReader(tt.wire), tt.limits)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: ReadMessage = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// Without a piece count, indexes and bitfield sizes are not checked.
+	m, err := ReadMessage(strings.NewReader("\x00\x00\x00\x05\x04\xff\xff\xff\xff"), MessageLimits{})
+	if err != nil || m.Index != 0xffffffff {
+		t.Errorf("unchecked have = %v, %v", m, err)
+	}
+}
+
+func TestMessage_String(t *testing.T) {
+	tests := []struct {
+		msg  *Message
+		want string
+	}{
+		{nil, "keep-alive"},
+		{&Message{ID: MsgInterested}, "interested"},
+		{&Message{ID: MsgHave, Index: 7}, "have 7"},
+		{&Message{ID: MsgRequest, Index: 1, Begin: 16384, Length: 16384}, "request 1+16384:16384"},
+		{&Message{ID: MsgPiece, Index: 1, Payload: make([]byte, 10)}, "piece 1+0:10"},
+		{&Message{ID: 99}, "MessageID(99)"},
+	}
+	for _, tt := range tests {
+		if got := tt.msg.String(); got != tt.want {
+			t.Errorf("String = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func BenchmarkReadMessage(b *testing.B) {
+	wire := (&Message{ID: MsgPiece, Index: 1, Payload: make([]byte, 16*1024)}).Encode()
+	r := bytes.NewReader(wire)
+	b.SetBytes(int64(len(wire)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(wire)
+		if _, err := ReadMessage(r, MessageLimits{PieceCount: 2}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
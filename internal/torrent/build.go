@@ -0,0 +1,268 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harioms1522/BitSwift/internal/bencode"
+)
+
+const (
+	minPieceLength     = 16 * 1024        // one block; the smallest useful piece
+	maxAutoPieceLength = 16 * 1024 * 1024 // largest piece length chosen automatically
+	targetPieceCount   = 1500             // automatic piece length aims for at most this many pieces
+)
+
+// Builder creates .torrent files from content on disk.
+// The zero value builds a trackerless torrent with an automatic piece length.
+type Builder struct {
+	Announce     string     // primary tracker URL; defaults to the first URL of AnnounceList
+	AnnounceList [][]string // tracker tiers (optional)
+	Comment      string
+	CreatedBy    string
+	CreationDate time.Time // zero omits the field
+	Private      bool      // set the private flag so clients use only the listed trackers
+	Source       string    // info.source tag, changing the info hash (optional)
+	PieceLength  int64     // power of two, at least 16 KiB; 0 chooses one from the total size
+	Workers      int       // goroutines hashing pieces; 0 means runtime.NumCPU()
+}
+
+// buildFile is one regular file to include, in torrent order.
+type buildFile struct {
+	osPath string
+	path   []string // components relative to the torrent root; nil for a single-file torrent
+	length int64
+}
+
+// Build walks the file or directory at path and returns the bencoded .torrent.
+// A directory becomes a multi-file torrent of the regular files beneath it in lexical
+// order; symlinks and other special files are skipped.
+func (b *Builder) Build(path string) ([]byte, error) {
+	// An absolute path gives "." and ".." a real base name for info.name.
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("create torrent: %w", err)
+	}
+	files, err := collectFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("create torrent: %w", err)
+	}
+	var total int64
+	for _, f := range files {
+		total += f.length
+	}
+	if total == 0 {
+		return nil, errors.New("create torrent: no data to hash")
+	}
+	names := &Meta{Info: Info{Name: filepath.Base(path)}}
+	for _, f := range files {
+		if f.path != nil {
+			names.Info.Files = append(names.Info.Files, File{Path: f.path})
+		}
+	}
+	if err := names.checkPaths(true); err != nil {
+		return nil, fmt.Errorf("create torrent: %w", err)
+	}
+
+	pieceLength := b.PieceLength
+	if pieceLength == 0 {
+		pieceLength = PieceLengthFor(total)
+	}
+	if pieceLength < minPieceLength || pieceLength&(pieceLength-1) != 0 {
+		return nil, fmt.Errorf("create torrent: piece length %d is not a power of two of at least %d", pieceLength, minPieceLength)
+	}
+	workers := b.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	pieces, err := hashPieces(files, total, pieceLength, workers)
+	if err != nil {
+		return nil, fmt.Errorf("create torrent: %w", err)
+	}
+
+	info := infoDict{
+		Name:        filepath.Base(path),
+		PieceLength: pieceLength,
+		Pieces:      pieces,
+		Source:      b.Source,
+	}
+	if files[0].path == nil {
+		info.Length = &total
+	} else {
+		for _, f := range files {
+			info.Files = append(info.Files, fileDict{Length: f.length, Path: f.path})
+		}
+	}
+	if b.Private {
+		info.Private = 1
+	}
+
+	root := metainfo{
+		Announce:     b.Announce,
+		AnnounceList: b.AnnounceList,
+		Comment:      optString(b.Comment),
+		CreatedBy:    optString(b.CreatedBy),
+		Info:         rawInfo{Dict: info},
+	}
+	if root.Announce == "" && len(b.AnnounceList) > 0 && len(b.AnnounceList[0]) > 0 {
+		root.Announce = b.AnnounceList[0][0]
+	}
+	if !b.CreationDate.IsZero() {
+		root.CreationDate = optInt(b.CreationDate.Unix())
+	}
+	return bencode.Marshal(root)
+}
+
+// PieceLengthFor returns the piece length Build chooses for content of the given total size:
+// the smallest power of two from 16 KiB to 16 MiB giving at most 1500 pieces.
+func PieceLengthFor(total int64) int64 {
+	length := int64(minPieceLength)
+	for length < maxAutoPieceLength && (total+length-1)/length > targetPieceCount {
+		length *= 2
+	}
+	return length
+}
+
+// collectFiles lists the files of a single-file or multi-file torrent rooted at path.
+func collectFiles(path string) ([]buildFile, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		if !st.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a regular file", path)
+		}
+		return []buildFile{{osPath: path, length: st.Size()}}, nil
+	}
+
+	var files []buildFile
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, buildFile{
+			osPath: p,
+			path:   strings.Split(filepath.ToSlash(rel), "/"),
+			length: fi.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s contains no files", path)
+	}
+	return files, nil
+}
+
+// pieceJob is one piece read from disk, waiting to be hashed.
+type pieceJob struct {
+	index int
+	data  []byte
+}
+
+// hashPieces reads the files as one stream and returns the concatenated SHA-1 hashes of
+// its pieces. Reading is sequential; hashing runs on workers goroutines, with one spare
+// buffer so the reader can fill a piece while the others are hashed.
+func hashPieces(files []buildFile, total, pieceLength int64, workers int) ([]byte, error) {
+	n := int((total + pieceLength - 1) / pieceLength)
+	pieces := make([]byte, n*sha1.Size)
+
+	free := make(chan []byte, workers+1)
+	for i := 0; i < workers+1; i++ {
+		free <- make([]byte, pieceLength)
+	}
+	jobs := make(chan pieceJob)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				sum := sha1.Sum(j.data)
+				copy(pieces[j.index*sha1.Size:], sum[:])
+				free <- j.data[:cap(j.data)]
+			}
+		}()
+	}
+
+	r := &filesReader{files: files}
+	defer r.Close()
+	var err error
+	for i := 0; i < n; i++ {
+		buf := <-free
+		size := min(pieceLength, total-int64(i)*pieceLength)
+		if _, err = io.ReadFull(r, buf[:size]); err != nil {
+			break
+		}
+		jobs <- pieceJob{index: i, data: buf[:size]}
+	}
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return pieces, nil
+}
+
+// filesReader reads the recorded length of each file in turn, opening one file at a time.
+type filesReader struct {
+	files []buildFile
+	cur   *os.File
+	left  int64 // bytes still to read from cur
+}
+
+func (r *filesReader) Read(p []byte) (int, error) {
+	for r.cur == nil || r.left == 0 {
+		r.Close()
+		if len(r.files) == 0 {
+			return 0, io.EOF
+		}
+		f, err := os.Open(r.files[0].osPath)
+		if err != nil {
+			return 0, err
+		}
+		r.cur, r.left = f, r.files[0].length
+		r.files = r.files[1:]
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.cur.Read(p)
+	r.left -= int64(n)
+	if err == io.EOF && r.left > 0 {
+		return n, fmt.Errorf("%s changed while hashing", r.cur.Name())
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *filesReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
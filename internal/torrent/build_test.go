@@ -0,0 +1,234 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectedPieces hashes data in pieceLength chunks.
+func expectedPieces(data []byte, pieceLength int) []byte {
+	var pieces []byte
+	for len(data) > 0 {
+		n := min(pieceLength, len(data))
+		sum := sha1.Sum(data[:n])
+		pieces = append(pieces, sum[:]...)
+		data = data[n:]
+	}
+	return pieces
+}
+
+func TestBuild_SingleFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 5000) // 50000 bytes, 4 pieces of 16 KiB
+	path := filepath.Join(t.TempDir(), "data.bin")
+	writeFile(t, path, content)
+
+	b := &Builder{
+		AnnounceList: [][]string{{"http://a/announce", "http://b/announce"}, {"udp://c:80"}},
+		Comment:      "test",
+		CreatedBy:    "BitSwift",
+		CreationDate: time.Unix(1700000000, 0),
+		Private:      true,
+		Workers:      3,
+	}
+	data, err := b.Build(path)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	meta, err := ParseFile(data)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	if meta.Info.Name != "data.bin" || meta.Info.Length != 50000 || meta.FileCount() != 1 {
+		t.Errorf("info = %q, length %d, %d files", meta.Info.Name, meta.Info.Length, meta.FileCount())
+	}
+	if meta.Info.PieceLength != minPieceLength {
+		t.Errorf("PieceLength = %d, want %d", meta.Info.PieceLength, minPieceLength)
+	}
+	if !bytes.Equal(meta.Info.Pieces, expectedPieces(content, minPieceLength)) {
+		t.Error("piece hashes do not match the content")
+	}
+	if meta.Announce != "http://a/announce" {
+		t.Errorf("Announce = %q, want first URL of the first tier", meta.Announce)
+	}
+	if !reflect.DeepEqual(meta.AnnounceList, b.AnnounceList) {
+		t.Errorf("AnnounceList = %v, want %v", meta.AnnounceList, b.AnnounceList)
+	}
+	for _, s := range []string{"7:comment4:test", "10:created by8:BitSwift", "13:creation datei1700000000e", "7:privatei1e"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("output does not contain %q", s)
+		}
+	}
+
+	// Building the same content again gives the same bytes and info hash.
+	again, err := b.Build(path)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Error("Build is not deterministic")
+	}
+}
+
+func TestBuild_Directory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "album")
+	files := map[string][]byte{
+		"b.txt":         bytes.Repeat([]byte("b"), 20000),
+		"a/2.txt":       bytes.Repeat([]byte("2"), 10),
+		"a/1.txt":       bytes.Repeat([]byte("1"), 30000),
+		"a/empty":       nil,
+		"c/d/e/deep.md": []byte("deep"),
+	}
+	for name, data := range files {
+		writeFile(t, filepath.Join(dir, filepath.FromSlash(name)), data)
+	}
+
+	data, err := (&Builder{Announce: "http://tracker/", PieceLength: 32 * 1024}).Build(dir)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	meta, err := ParseFile(data)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	order := []string{"a/1.txt", "a/2.txt", "a/empty", "b.txt", "c/d/e/deep.md"}
+	var content []byte
+	if meta.Info.Name != "album" || len(meta.Info.Files) != len(order) {
+		t.Fatalf("Name = %q, %d files, want album with %d files", meta.Info.Name, len(meta.Info.Files), len(order))
+	}
+	for i, name := range order {
+		f := meta.Info.Files[i]
+		if got := strings.Join(f.Path, "/"); got != name || f.Length != int64(len(files[name])) {
+			t.Errorf("file %d = %s (%d bytes), want %s (%d bytes)", i, got, f.Length, name, len(files[name]))
+		}
+		content = append(content, files[name]...)
+	}
+	if !bytes.Equal(meta.Info.Pieces, expectedPieces(content, 32*1024)) {
+		t.Error("piece hashes do not match the concatenated files")
+	}
+	if meta.Info.Length != 0 {
+		t.Error("multi-file torrent has a top-level length")
+	}
+}
+
+func TestBuild_CurrentDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "album")
+	writeFile(t, filepath.Join(dir, "a.txt"), []byte("hello"))
+	chdir(t, dir)
+
+	for _, path := range []string{".", "./", "../album"} {
+		data, err := (&Builder{}).Build(path)
+		if err != nil {
+			t.Fatalf("Build(%q): %v", path, err)
+		}
+		meta, err := ParseFile(data)
+		if err != nil {
+			t.Fatalf("ParseFile: %v", err)
+		}
+		if meta.Info.Name != "album" {
+			t.Errorf("Build(%q): Name = %q, want album", path, meta.Info.Name)
+		}
+	}
+}
+
+// chdir changes the working directory for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestBuild_Errors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "f"), []byte("x"))
+	writeFile(t, filepath.Join(dir, "empty", "zero"), nil)
+
+	tests := []struct {
+		name        string
+		path        string
+		pieceLength int64
+		want        string
+	}{
+		{"missing", filepath.Join(dir, "nope"), 0, "no such file"},
+		{"no data", filepath.Join(dir, "empty"), 0, "no data to hash"},
+		{"not power of two", filepath.Join(dir, "f"), 20000, "piece length"},
+		{"too small", filepath.Join(dir, "f"), 8192, "piece length"},
+	}
+	for _, tt := range tests {
+		_, err := (&Builder{PieceLength: tt.pieceLength}).Build(tt.path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Build = %v, want error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestPieceLengthFor(t *testing.T) {
+	tests := []struct {
+		total int64
+		want  int64
+	}{
+		{1, 16 * 1024},
+		{1500 * 16 * 1024, 16 * 1024},
+		{1500*16*1024 + 1, 32 * 1024},
+		{6345887744, 8 * 1024 * 1024},
+		{1 << 40, 16 * 1024 * 1024},
+	}
+	for _, tt := range tests {
+		if got := PieceLengthFor(tt.total); got != tt.want {
+			t.Errorf("PieceLengthFor(%d) = %d, want %d", tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestBuild_UnsafeName(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	writeFile(t, filepath.Join(dir, "aux.txt"), []byte("x"))
+	_, err := (&Builder{}).Build(dir)
+	var pe *PathError
+	if !errors.As(err, &pe) || pe.Component != "aux.txt" {
+		t.Errorf("Build = %v, want *PathError for aux.txt", err)
+	}
+}
+
+func TestBuild_Source(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f")
+	writeFile(t, path, []byte("content"))
+	plain, err := (&Builder{}).Build(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagged, err := (&Builder{Source: "TRK", Private: true}).Build(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := ParseFile(plain)
+	b, _ := ParseFile(tagged)
+	if b.Info.Source != "TRK" || !b.Info.Private || a.Info.Private {
+		t.Errorf("Source, Private = %q, %v", b.Info.Source, b.Info.Private)
+	}
+	if a.InfoHash == b.InfoHash {
+		t.Error("source tag and private flag did not change the info hash")
+	}
+}
@@ -0,0 +1,134 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrOutOfRange is returned for a piece or byte range outside the torrent's data.
+var ErrOutOfRange = errors.New("torrent: range outside torrent data")
+
+// Layout maps the torrent's pieces onto its files. The content of all files, in order,
+// forms one stream that is split into pieces of PieceLength bytes; the last piece may be shorter.
+type Layout struct {
+	PieceLength int64
+	PieceCount  int
+	TotalLength int64
+
+	files   []File
+	offsets []int64 // offsets[i] is where files[i] starts in the stream
+}
+
+// Segment is the part of one file covered by a byte range of the stream.
+type Segment struct {
+	File   int   // index into Layout.Files
+	Offset int64 // offset within the file
+	Length int64
+}
+
+// Layout computes the piece-to-file mapping of m's v1 pieces. Padding files of a hybrid
+// torrent are part of the stream; a v2-only torrent has no v1 layout.
+func (m *Meta) Layout() (*Layout, error) {
+	if !m.IsV1() && m.IsV2() {
+		return nil, errors.New("torrent: v2-only torrent has no v1 piece layout")
+	}
+	if m.Info.PieceLength <= 0 {
+		return nil, fmt.Errorf("torrent: invalid piece length %d", m.Info.PieceLength)
+	}
+	files := m.Info.Files
+	if len(files) == 0 {
+		files = []File{{Length: m.Info.Length}}
+	}
+	l := &Layout{PieceLength: m.Info.PieceLength, files: files, offsets: make([]int64, len(files))}
+	for i, f := range files {
+		if f.Length < 0 {
+			return nil, fmt.Errorf("torrent: file %d has negative length %d", i, f.Length)
+		}
+		l.offsets[i] = l.TotalLength
+		l.TotalLength += f.Length
+	}
+	l.PieceCount = int((l.TotalLength + l.PieceLength - 1) / l.PieceLength)
+	return l, nil
+}
+
+// Files returns the files in stream order. A single-file torrent has one File with a nil
+// Path; the file is named by Info.Name.
+func (l *Layout) Files() []File {
+	return l.files
+}
+
+// FileOffset returns where file i starts in the stream.
+func (l *Layout) FileOffset(i int) int64 {
+	return l.offsets[i]
+}
+
+// PieceOffset returns where piece index starts in the stream.
+func (l *Layout) PieceOffset(index int) int64 {
+	return int64(index) * l.PieceLength
+}
+
+// PieceSize returns the exact length of piece index: PieceLength for all but the last piece.
+func (l *Layout) PieceSize(index int) int64 {
+	if index < 0 || index >= l.PieceCount {
+		return 0
+	}
+	return min(l.PieceLength, l.TotalLength-l.PieceOffset(index))
+}
+
+// LastPieceLength returns the length of the last piece, or 0 if the torrent is empty.
+func (l *Layout) LastPieceLength() int64 {
+	return l.PieceSize(l.PieceCount - 1)
+}
+
+// Segments returns the file segments holding length bytes starting at offset in the stream,
+// in order. Zero-length files hold no bytes and never appear.
+func (l *Layout) Segments(offset, length int64) ([]Segment, error) {
+	if offset < 0 || length < 0 || offset > l.TotalLength || length > l.TotalLength-offset {
+		return nil, ErrOutOfRange
+	}
+	// First file that ends after offset.
+	i := sort.Search(len(l.files), func(i int) bool { return l.offsets[i]+l.files[i].Length > offset })
+	var segs []Segment
+	for ; length > 0; i++ {
+		f := l.files[i]
+		if f.Length == 0 {
+			continue
+		}
+		off := offset - l.offsets[i]
+		n := min(length, f.Length-off)
+		segs = append(segs, Segment{File: i, Offset: off, Length: n})
+		offset += n
+		length -= n
+	}
+	return segs, nil
+}
+
+// PieceSegments returns the file segments holding piece index.
+func (l *Layout) PieceSegments(index int) ([]Segment, error) {
+	if index < 0 || index >= l.PieceCount {
+		return nil, ErrOutOfRange
+	}
+	return l.Segments(l.PieceOffset(index), l.PieceSize(index))
+}
+
+// BlockSegments returns the file segments holding length bytes at begin within piece index,
+// as addressed by a peer request message.
+func (l *Layout) BlockSegments(index int, begin, length int64) ([]Segment, error) {
+	if index < 0 || index >= l.PieceCount || begin < 0 || length < 0 || begin+length > l.PieceSize(index) {
+		return nil, ErrOutOfRange
+	}
+	return l.Segments(l.PieceOffset(index)+begin, length)
+}
+
+// FilePieces returns the half-open range [first, end) of pieces that hold bytes of file i.
+// The range is empty for a zero-length file.
+func (l *Layout) FilePieces(i int) (first, end int) {
+	start := l.offsets[i]
+	first = int(start / l.PieceLength)
+	if l.files[i].Length == 0 {
+		return first, first
+	}
+	stop := start + l.files[i].Length
+	return first, int((stop + l.PieceLength - 1) / l.PieceLength)
+}
@@ -0,0 +1,211 @@
+package torrent
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func multiFileMeta(pieceLength int64, lengths ...int64) *Meta {
+	m := &Meta{Info: Info{Name: "multi", PieceLength: pieceLength}}
+	for i, n := range lengths {
+		m.Info.Files = append(m.Info.Files, File{Path: []string{string(rune('a' + i))}, Length: n})
+	}
+	return m
+}
+
+// layoutCases covers single-file, multi-file and zero-length-file torrents, with files
+// smaller than, equal to and spanning several pieces.
+var layoutCases = []struct {
+	name string
+	meta *Meta
+}{
+	{"single exact", &Meta{Info: Info{Name: "s", PieceLength: 4, Length: 12}}},
+	{"single short last", &Meta{Info: Info{Name: "s", PieceLength: 4, Length: 10}}},
+	{"single one byte", &Meta{Info: Info{Name: "s", PieceLength: 4, Length: 1}}},
+	{"single empty", &Meta{Info: Info{Name: "s", PieceLength: 4}}},
+	{"multi aligned", multiFileMeta(4, 4, 8, 4)},
+	{"multi spanning", multiFileMeta(4, 3, 6, 1, 5)},
+	{"multi small files", multiFileMeta(8, 1, 2, 1, 1, 3)},
+	{"zero-length first", multiFileMeta(4, 0, 5, 3)},
+	{"zero-length middle", multiFileMeta(4, 3, 0, 0, 6)},
+	{"zero-length last", multiFileMeta(4, 7, 0)},
+	{"zero-length at boundary", multiFileMeta(4, 4, 0, 4)},
+	{"all zero-length", multiFileMeta(4, 0, 0)},
+}
+
+// byteOwners maps every byte of the stream to its file and offset within that file.
+func byteOwners(l *Layout) []Segment {
+	var owners []Segment
+	for i, f := range l.Files() {
+		for off := int64(0); off < f.Length; off++ {
+			owners = append(owners, Segment{File: i, Offset: off, Length: 1})
+		}
+	}
+	return owners
+}
+
+// expand turns segments into one Segment per byte.
+func expand(segs []Segment) []Segment {
+	var out []Segment
+	for _, s := range segs {
+		for off := s.Offset; off < s.Offset+s.Length; off++ {
+			out = append(out, Segment{File: s.File, Offset: off, Length: 1})
+		}
+	}
+	return out
+}
+
+func TestLayout_Segments(t *testing.T) {
+	for _, tc := range layoutCases {
+		l, err := tc.meta.Layout()
+		if err != nil {
+			t.Fatalf("%s: Layout: %v", tc.name, err)
+		}
+		owners := byteOwners(l)
+		if int64(len(owners)) != l.TotalLength {
+			t.Fatalf("%s: TotalLength = %d, want %d", tc.name, l.TotalLength, len(owners))
+		}
+		for off := int64(0); off <= l.TotalLength; off++ {
+			for n := int64(0); off+n <= l.TotalLength; n++ {
+				segs, err := l.Segments(off, n)
+				if err != nil {
+					t.Fatalf("%s: Segments(%d, %d): %v", tc.name, off, n, err)
+				}
+				if got, want := expand(segs), owners[off:off+n]; len(want) > 0 && !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: Segments(%d, %d) = %v, covers %v, want %v", tc.name, off, n, segs, got, want)
+				}
+				for i, s := range segs {
+					if s.Length <= 0 {
+						t.Errorf("%s: Segments(%d, %d) has empty segment %v", tc.name, off, n, s)
+					}
+					if i > 0 && s.File <= segs[i-1].File {
+						t.Errorf("%s: Segments(%d, %d) = %v, want one segment per file in order", tc.name, off, n, segs)
+					}
+				}
+			}
+		}
+		if _, err := l.Segments(0, l.TotalLength+1); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("%s: Segments past the end = %v, want ErrOutOfRange", tc.name, err)
+		}
+		if _, err := l.Segments(-1, 1); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("%s: Segments(-1, 1) = %v, want ErrOutOfRange", tc.name, err)
+		}
+	}
+}
+
+func TestLayout_Pieces(t *testing.T) {
+	for _, tc := range layoutCases {
+		l, err := tc.meta.Layout()
+		if err != nil {
+			t.Fatalf("%s: Layout: %v", tc.name, err)
+		}
+		owners := byteOwners(l)
+		var sum int64
+		for p := 0; p < l.PieceCount; p++ {
+			size := l.PieceSize(p)
+			if size <= 0 || size > l.PieceLength || (p < l.PieceCount-1 && size != l.PieceLength) {
+				t.Errorf("%s: PieceSize(%d) = %d", tc.name, p, size)
+			}
+			segs, err := l.PieceSegments(p)
+			if err != nil {
+				t.Fatalf("%s: PieceSegments(%d): %v", tc.name, p, err)
+			}
+			if got, want := expand(segs), owners[sum:sum+size]; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: PieceSegments(%d) = %v", tc.name, p, segs)
+			}
+			for begin := int64(0); begin <= size; begin++ {
+				for n := int64(0); begin+n <= size; n++ {
+					segs, err := l.BlockSegments(p, begin, n)
+					if err != nil {
+						t.Fatalf("%s: BlockSegments(%d, %d, %d): %v", tc.name, p, begin, n, err)
+					}
+					if got, want := expand(segs), owners[sum+begin:sum+begin+n]; n > 0 && !reflect.DeepEqual(got, want) {
+						t.Errorf("%s: BlockSegments(%d, %d, %d) = %v", tc.name, p, begin, n, segs)
+					}
+				}
+			}
+			if _, err := l.BlockSegments(p, 0, size+1); !errors.Is(err, ErrOutOfRange) {
+				t.Errorf("%s: BlockSegments past the piece = %v, want ErrOutOfRange", tc.name, err)
+			}
+			sum += size
+		}
+		if sum != l.TotalLength {
+			t.Errorf("%s: pieces add up to %d bytes, want %d", tc.name, sum, l.TotalLength)
+		}
+		if want := l.PieceSize(l.PieceCount - 1); l.LastPieceLength() != want {
+			t.Errorf("%s: LastPieceLength = %d, want %d", tc.name, l.LastPieceLength(), want)
+		}
+		if _, err := l.PieceSegments(l.PieceCount); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("%s: PieceSegments(PieceCount) = %v, want ErrOutOfRange", tc.name, err)
+		}
+	}
+}
+
+func TestLayout_FilePieces(t *testing.T) {
+	for _, tc := range layoutCases {
+		l, err := tc.meta.Layout()
+		if err != nil {
+			t.Fatalf("%s: Layout: %v", tc.name, err)
+		}
+		for i := range l.Files() {
+			// Brute force: the pieces that contain any byte of file i.
+			want := []int{}
+			for p := 0; p < l.PieceCount; p++ {
+				segs, _ := l.PieceSegments(p)
+				for _, s := range segs {
+					if s.File == i {
+						want = append(want, p)
+						break
+					}
+				}
+			}
+			first, end := l.FilePieces(i)
+			got := []int{}
+			for p := first; p < end; p++ {
+				got = append(got, p)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: FilePieces(%d) = [%d, %d), want pieces %v", tc.name, i, first, end, want)
+			}
+		}
+	}
+}
+
+func TestLayout_Known(t *testing.T) {
+	l, err := multiFileMeta(4, 3, 6, 1, 5).Layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.TotalLength != 15 || l.PieceCount != 4 || l.LastPieceLength() != 3 {
+		t.Errorf("layout = %d bytes, %d pieces, last %d; want 15, 4, 3", l.TotalLength, l.PieceCount, l.LastPieceLength())
+	}
+	segs, _ := l.PieceSegments(2)
+	want := []Segment{{File: 1, Offset: 5, Length: 1}, {File: 2, Offset: 0, Length: 1}, {File: 3, Offset: 0, Length: 2}}
+	if !reflect.DeepEqual(segs, want) {
+		t.Errorf("PieceSegments(2) = %v, want %v", segs, want)
+	}
+	if first, end := l.FilePieces(1); first != 0 || end != 3 {
+		t.Errorf("FilePieces(1) = [%d, %d), want [0, 3)", first, end)
+	}
+	if l.FileOffset(3) != 10 {
+		t.Errorf("FileOffset(3) = %d, want 10", l.FileOffset(3))
+	}
+
+	single, _ := (&Meta{Info: Info{Name: "s", PieceLength: 16384, Length: 100}}).Layout()
+	if files := single.Files(); len(files) != 1 || files[0].Path != nil || files[0].Length != 100 {
+		t.Errorf("single-file Files = %v, want one file with nil Path", files)
+	}
+	if single.LastPieceLength() != 100 {
+		t.Errorf("LastPieceLength = %d, want 100", single.LastPieceLength())
+	}
+}
+
+func TestLayout_Invalid(t *testing.T) {
+	if _, err := (&Meta{Info: Info{Length: 10}}).Layout(); err == nil {
+		t.Error("Layout accepted a zero piece length")
+	}
+	if _, err := multiFileMeta(4, 3, -1).Layout(); err == nil {
+		t.Error("Layout accepted a negative file length")
+	}
+}
@@ -0,0 +1,136 @@
+package torrent
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// PathError reports an info.name or info.files path that is unsafe to use as a file name.
+type PathError struct {
+	Field     string // e.g. "info.name", "info.files[3].path", or "path" from SafeRelativePath
+	Component string // the offending path component
+	Reason    string
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("unsafe path in %s: %q %s", e.Field, e.Component, e.Reason)
+}
+
+// windowsReserved are device names that cannot be used as file names on Windows, with or
+// without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// checkComponent returns why s cannot be used as one file or directory name, or "" if it can.
+// The base rules only reject names that would leave the download directory: ParseFile applies
+// them, so any torrent with POSIX-valid names can at least be read. With portable set, the
+// rules of the strictest common platform apply too, so a name that passes can be written to
+// disk anywhere; Validate and SafeRelativePath use those.
+func checkComponent(s string, portable bool) string {
+	switch {
+	case s == "." || s == "..":
+		return "refers to a directory"
+	case strings.ContainsAny(s, `/\`):
+		return "contains a path separator"
+	case strings.Contains(s, "\x00"):
+		return "contains a NUL byte"
+	case !portable:
+		return ""
+	case s == "":
+		return "is empty"
+	case strings.Contains(s, ":"):
+		return "contains a drive or stream separator"
+	case strings.ContainsFunc(s, func(r rune) bool { return r < 0x20 || r == 0x7f }):
+		return "contains a control character"
+	case strings.HasSuffix(s, ".") || strings.HasSuffix(s, " "):
+		return "ends with a dot or space"
+	}
+	base, _, _ := strings.Cut(s, ".")
+	if windowsReserved[strings.ToUpper(strings.TrimRight(base, " "))] {
+		return "is a reserved device name"
+	}
+	return ""
+}
+
+// checkPaths verifies that info.name and every info.files path cannot escape the download
+// directory, and with portable set that they can be created on every platform. The
+// name.utf-8 and path.utf-8 variants are checked too when present, since a client may
+// prefer them for display or for naming files.
+func (m *Meta) checkPaths(portable bool) error {
+	// A missing name is left to Validate, which reports it as MissingName.
+	if m.Info.Name != "" {
+		if err := checkName("info.name", m.Info.Name, portable); err != nil {
+			return err
+		}
+	}
+	if m.Info.NameUTF8 != "" {
+		if err := checkName("info.name.utf-8", m.Info.NameUTF8, portable); err != nil {
+			return err
+		}
+	}
+	for i, f := range m.Info.Files {
+		if err := checkFilePath(fmt.Sprintf("info.files[%d].path", i), f.Path, portable); err != nil {
+			return err
+		}
+		if f.PathUTF8 != nil {
+			if err := checkFilePath(fmt.Sprintf("info.files[%d].path.utf-8", i), f.PathUTF8, portable); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range m.Info.FileTree {
+		if err := checkFilePath(f.field(), f.Path, portable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkName checks name, the value of field.
+func checkName(field, name string, portable bool) *PathError {
+	if reason := checkComponent(name, portable); reason != "" {
+		return &PathError{Field: field, Component: name, Reason: reason}
+	}
+	return nil
+}
+
+// checkFilePath checks path, the value of field. Only the portable rules require components.
+func checkFilePath(field string, path []string, portable bool) *PathError {
+	if portable && len(path) == 0 {
+		return &PathError{Field: field, Reason: "has no components"}
+	}
+	for _, c := range path {
+		if reason := checkComponent(c, portable); reason != "" {
+			return &PathError{Field: field, Component: c, Reason: reason}
+		}
+	}
+	return nil
+}
+
+// SafeRelativePath returns the path of f relative to the download directory: info.name
+// for a single-file torrent (f.Path is nil), or info.name joined with f.Path. Code that
+// creates or opens files on disk must use it rather than joining names itself; it returns a
+// *PathError for any name that could escape the download directory.
+func (m *Meta) SafeRelativePath(f File) (string, error) {
+	if err := checkName("info.name", m.Info.Name, true); err != nil {
+		return "", err
+	}
+	parts := []string{m.Info.Name}
+	for _, c := range f.Path {
+		if reason := checkComponent(c, true); reason != "" {
+			return "", &PathError{Field: "path", Component: c, Reason: reason}
+		}
+		parts = append(parts, c)
+	}
+	p := filepath.Join(parts...)
+	if !filepath.IsLocal(p) {
+		return "", &PathError{Field: "path", Component: p, Reason: "is not a local path"}
+	}
+	return p, nil
+}
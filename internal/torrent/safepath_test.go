@@ -0,0 +1,138 @@
+package torrent
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/harioms1522/BitSwift/internal/bencode"
+)
+
+func TestCheckComponent(t *testing.T) {
+	safe := []string{"a", "file.txt", "..hidden", "a..b", "Ünïcødé 名前", "CONSOLE", "com10", ".gitignore"}
+	traversal := []string{".", "..", "a/b", "/etc", `a\b`, "a\x00b"}
+	// Valid POSIX names that cannot be created on Windows.
+	unportable := []string{"", "C:", "file:stream", "tab\there", "dot.", "space ", "CON", "con.txt", "Nul", "lpt1.log", "COM9 .x"}
+	for _, portable := range []bool{false, true} {
+		for _, s := range safe {
+			if reason := checkComponent(s, portable); reason != "" {
+				t.Errorf("checkComponent(%q, %v) = %q, want safe", s, portable, reason)
+			}
+		}
+		for _, s := range traversal {
+			if reason := checkComponent(s, portable); reason == "" {
+				t.Errorf("checkComponent(%q, %v) = safe, want rejected", s, portable)
+			}
+		}
+		for _, s := range unportable {
+			if reason := checkComponent(s, portable); (reason == "") == portable {
+				t.Errorf("checkComponent(%q, %v) = %q", s, portable, reason)
+			}
+		}
+	}
+}
+
+// torrentWithFiles bencodes a multi-file torrent with one byte in each of the given paths.
+func torrentWithFiles(t *testing.T, name string, paths ...[]string) []byte {
+	t.Helper()
+	info := infoDict{Name: name, PieceLength: 16384, Pieces: make([]byte, 20)}
+	for _, p := range paths {
+		info.Files = append(info.Files, fileDict{Length: 1, Path: p})
+	}
+	data, err := bencode.Marshal(metainfo{Info: rawInfo{Dict: info}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseFile_UnsafePaths(t *testing.T) {
+	tests := []struct {
+		name      string
+		torrent   string
+		paths     [][]string
+		field     string
+		component string
+	}{
+		{"traversal", "t", [][]string{{"ok"}, {"..", "..", "etc", "passwd"}}, "info.files[1].path", ".."},
+		{"absolute", "t", [][]string{{"/etc/passwd"}}, "info.files[0].path", "/etc/passwd"},
+		{"NUL byte", "t", [][]string{{"a\x00.txt"}}, "info.files[0].path", "a\x00.txt"},
+		{"windows separator", "t", [][]string{{`..\..\x`}}, "info.files[0].path", `..\..\x`},
+		{"bad name", "..", [][]string{{"a"}}, "info.name", ".."},
+	}
+	for _, tt := range tests {
+		_, err := ParseFile(torrentWithFiles(t, tt.torrent, tt.paths...))
+		var pe *PathError
+		if !errors.As(err, &pe) {
+			t.Errorf("%s: ParseFile = %v, want *PathError", tt.name, err)
+			continue
+		}
+		if pe.Field != tt.field || pe.Component != tt.component {
+			t.Errorf("%s: PathError = {%s, %q}, want {%s, %q}", tt.name, pe.Field, pe.Component, tt.field, tt.component)
+		}
+	}
+
+	if _, err := ParseFile(torrentWithFiles(t, "album", []string{"disc 1", "01.flac"}, []string{".nfo"})); err != nil {
+		t.Errorf("ParseFile rejected safe paths: %v", err)
+	}
+
+	// File tree paths are reported by their path.
+	tree := &Meta{Info: Info{Name: "t", FileTree: []TreeFile{{Path: []string{"a"}}, {Path: []string{"dir", "..", "x"}}}}}
+	var pe *PathError
+	if err := tree.checkPaths(false); !errors.As(err, &pe) || pe.Field != "info.file tree.dir/../x" {
+		t.Errorf("checkPaths = %v, want *PathError in info.file tree.dir/../x", err)
+	}
+}
+
+func TestParseFile_UnportablePaths(t *testing.T) {
+	// Names that are valid on POSIX parse, so the torrent can be summarized; Validate and
+	// SafeRelativePath, which guard writing to disk, still reject them.
+	data := torrentWithFiles(t, "a:b", []string{"CON"}, []string{"dir", ""}, []string{}, []string{"dot."})
+	meta, err := ParseFile(data)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	var ve *ValidationError
+	if err := meta.Validate(); !errors.As(err, &ve) {
+		t.Fatalf("Validate = %v, want *ValidationError", err)
+	}
+	var fields []string
+	for _, p := range ve.Problems {
+		if p.Kind == UnsafePath {
+			fields = append(fields, p.Field)
+		}
+	}
+	want := []string{"info.name", "info.files[0].path", "info.files[1].path", "info.files[2].path", "info.files[3].path"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("UnsafePath problems in %v, want %v", fields, want)
+	}
+	var pe *PathError
+	if _, err := meta.SafeRelativePath(meta.Info.Files[0]); !errors.As(err, &pe) {
+		t.Errorf("SafeRelativePath = %v, want *PathError", err)
+	}
+}
+
+func TestSafeRelativePath(t *testing.T) {
+	multi := &Meta{Info: Info{Name: "album", Files: []File{{Path: []string{"disc 1", "01.flac"}}}}}
+	got, err := multi.SafeRelativePath(multi.Info.Files[0])
+	if want := filepath.Join("album", "disc 1", "01.flac"); err != nil || got != want {
+		t.Errorf("SafeRelativePath = %q, %v, want %q", got, err, want)
+	}
+
+	single := &Meta{Info: Info{Name: "movie.mkv", Length: 10}}
+	got, err = single.SafeRelativePath(File{Length: 10})
+	if err != nil || got != "movie.mkv" {
+		t.Errorf("single-file SafeRelativePath = %q, %v, want movie.mkv", got, err)
+	}
+
+	// Meta values built by hand are checked too.
+	var pe *PathError
+	if _, err := multi.SafeRelativePath(File{Path: []string{"..", "x"}}); !errors.As(err, &pe) || pe.Component != ".." {
+		t.Errorf("SafeRelativePath(..) = %v, want *PathError for ..", err)
+	}
+	bad := &Meta{Info: Info{Name: "/tmp"}}
+	if _, err := bad.SafeRelativePath(File{}); !errors.As(err, &pe) || pe.Field != "info.name" {
+		t.Errorf("SafeRelativePath with bad name = %v, want *PathError in info.name", err)
+	}
+}
@@ -2,9 +2,12 @@ package torrent
 
 import (
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/harioms1522/BitSwift/internal/bencode"
 )
@@ -14,7 +17,15 @@ type Meta struct {
 	Announce     string     // primary tracker URL
 	AnnounceList [][]string // backup trackers (optional)
 	Info         Info
-	InfoHash     [20]byte // SHA-1 of bencoded info dict
+	InfoHash     [20]byte            // SHA-1 of bencoded info dict; truncated InfoHashV2 for a v2-only torrent
+	InfoHashV2   [32]byte            // SHA-256 of bencoded info dict (v2 and hybrid torrents)
+	InfoBytes    bencode.RawMessage  // exact bencoded info dict the hashes are computed from
+	PieceLayers  map[[32]byte][]byte // v2: concatenated SHA-256 piece hashes, keyed by pieces root
+
+	Comment      string    // free-form comment (optional)
+	CreatedBy    string    // program that created the torrent (optional)
+	CreationDate time.Time // zero if absent
+	Encoding     string    // character encoding of the strings in the info dict (optional)
 }
 
 // Info is the parsed "info" dictionary.
@@ -24,138 +35,223 @@ type Info struct {
 	Pieces      []byte // concatenated 20-byte SHA-1 hashes
 	Length      int64  // single-file: total file size
 	Files       []File // multi-file: list of path + length
+
+	NameUTF8 string // name.utf-8, the UTF-8 form of Name when Encoding is not UTF-8 (optional)
+	Private  bool   // BEP 27: peers may only come from the torrent's trackers
+	Source   string // tag distinguishing otherwise identical torrents, e.g. per tracker (optional)
+
+	hasLength bool // info.length was present, possibly as 0
+
+	MetaVersion int        // 2 for v2 and hybrid torrents (BEP 52), 0 otherwise
+	FileTree    []TreeFile // v2: files of the file tree, in order
 }
 
 // File is one entry in info.files (multi-file torrent).
 type File struct {
-	Path   []string // path components
-	Length int64
+	Path     []string // path components
+	Length   int64
+	PathUTF8 []string // path.utf-8, the UTF-8 form of Path (optional)
+	Attr     string   // BEP 47 attributes, e.g. "p" for a padding file (optional)
 }
 
-// ParseFile reads and parses a .torrent file, returning metadata and info hash.
-func ParseFile(data []byte) (*Meta, error) {
-	root, infoRaw, err := bencode.DecodeWithInfo(data)
-	if err != nil {
-		return nil, fmt.Errorf("invalid torrent: %w", err)
-	}
-	dict, ok := root.(map[string]bencode.Value)
-	if !ok {
-		return nil, errors.New("invalid torrent: root is not a dictionary")
+// IsPadding reports whether f is a padding file, which aligns the next file to a piece
+// boundary and is not written to disk.
+func (f File) IsPadding() bool {
+	return strings.Contains(f.Attr, "p")
+}
+
+// metainfo is the bencoded root dictionary of a .torrent file.
+type metainfo struct {
+	Announce     string     `bencode:"announce,omitempty"`
+	AnnounceList [][]string `bencode:"announce-list,omitempty"`
+	Comment      optString  `bencode:"comment,omitempty"`
+	CreatedBy    optString  `bencode:"created by,omitempty"`
+	CreationDate optInt     `bencode:"creation date,omitempty"`
+	Encoding     optString  `bencode:"encoding,omitempty"`
+	Info         rawInfo    `bencode:"info"`
+
+	PieceLayers map[string][]byte `bencode:"piece layers,omitempty"`
+}
+
+// optString is an optional display field: a value of the wrong type is dropped rather than
+// making the whole torrent unreadable.
+type optString string
+
+func (s *optString) UnmarshalBencode(data []byte) error {
+	var v string
+	if bencode.Unmarshal(data, &v) == nil {
+		*s = optString(v)
 	}
-	if infoRaw == nil {
-		return nil, errors.New("invalid torrent: missing info dictionary")
+	return nil
+}
+
+// optInt is the integer counterpart of optString.
+type optInt int64
+
+func (n *optInt) UnmarshalBencode(data []byte) error {
+	var v int64
+	if bencode.Unmarshal(data, &v) == nil {
+		*n = optInt(v)
 	}
+	return nil
+}
 
-	meta := &Meta{}
-	meta.InfoHash = sha1.Sum(infoRaw)
+// rawInfo decodes the "info" dictionary and hashes its exact bytes for the info hash.
+type rawInfo struct {
+	Present bool
+	Hash    [20]byte
+	HashV2  [32]byte           // only computed for meta version 2
+	Raw     bencode.RawMessage // exact bytes of the dict; nil for one built in memory
+	Dict    infoDict
+}
 
-	if v, ok := dict["announce"]; ok {
-		if s, ok := bytesVal(v); ok {
-			meta.Announce = string(s)
-		}
+func (r *rawInfo) UnmarshalBencode(data []byte) error {
+	r.Present = true
+	r.Hash = sha1.Sum(data)
+	if err := r.Raw.UnmarshalBencode(data); err != nil {
+		return err
 	}
-	if v, ok := dict["announce-list"]; ok {
-		if list, ok := v.([]bencode.Value); ok {
-			for _, tier := range list {
-				if tierList, ok := tier.([]bencode.Value); ok {
-					var urls []string
-					for _, u := range tierList {
-						if s, ok := bytesVal(u); ok {
-							urls = append(urls, string(s))
-						}
-					}
-					if len(urls) > 0 {
-						meta.AnnounceList = append(meta.AnnounceList, urls)
-					}
-				}
-			}
-		}
+	if err := bencode.UnmarshalWithOptions(data, &r.Dict, decodeOptions); err != nil {
+		return err
+	}
+	if r.Dict.MetaVersion == 2 {
+		r.HashV2 = sha256.Sum256(data)
+	}
+	return nil
+}
+
+// MarshalBencode writes the parsed bytes back unchanged, so the info hash survives a
+// round trip; a dict built in memory is encoded from Dict.
+func (r rawInfo) MarshalBencode() ([]byte, error) {
+	if len(r.Raw) > 0 {
+		return r.Raw.MarshalBencode()
 	}
+	return bencode.Marshal(r.Dict)
+}
+
+// infoDict is the bencoded "info" dictionary.
+type infoDict struct {
+	Name        string     `bencode:"name"`
+	PieceLength int64      `bencode:"piece length"`
+	Pieces      []byte     `bencode:"pieces"`
+	Length      *int64     `bencode:"length,omitempty"` // nil when absent, to tell an explicit 0 apart
+	Files       []fileDict `bencode:"files,omitempty"`
+	Private     int64      `bencode:"private,omitempty"`
+	Source      string     `bencode:"source,omitempty"`
+	NameUTF8    string     `bencode:"name.utf-8,omitempty"`
+	MetaVersion int64      `bencode:"meta version,omitempty"`
+	FileTree    *fileTree  `bencode:"file tree,omitempty"`
+}
+
+// fileDict is one entry in the bencoded info.files list.
+type fileDict struct {
+	Length   int64    `bencode:"length"`
+	Path     []string `bencode:"path"`
+	PathUTF8 []string `bencode:"path.utf-8,omitempty"`
+	Attr     string   `bencode:"attr,omitempty"`
+}
+
+// decodeOptions decodes byte strings without copying; the piece hashes are by far the
+// largest value in a torrent file.
+var decodeOptions = bencode.DecoderOptions{ZeroCopy: true}
 
-	infoVal, ok := dict["info"]
-	if !ok {
-		return nil, errors.New("invalid torrent: missing info")
+// ParseFile reads and parses a .torrent file, returning metadata and info hash.
+// Info.Pieces aliases data, so data must not be modified while the Meta is in use.
+func ParseFile(data []byte) (*Meta, error) {
+	return parseFile(data, decodeOptions)
+}
+
+// ParseInfo parses a bare bencoded info dictionary, such as one fetched from peers for a
+// magnet link. The returned Meta has no trackers. info is copied, so the caller may reuse it.
+func ParseInfo(info []byte) (*Meta, error) {
+	data := make([]byte, 0, len(info)+8)
+	data = append(data, "d4:info"...)
+	data = append(data, info...)
+	data = append(data, 'e')
+	return ParseFile(data)
+}
+
+func parseFile(data []byte, opts bencode.DecoderOptions) (*Meta, error) {
+	var root metainfo
+	if err := bencode.UnmarshalWithOptions(data, &root, opts); err != nil {
+		return nil, fmt.Errorf("invalid torrent: %w", err)
 	}
-	infoDict, ok := infoVal.(map[string]bencode.Value)
-	if !ok {
-		return nil, errors.New("invalid torrent: info is not a dictionary")
+	if !root.Info.Present {
+		return nil, errors.New("invalid torrent: missing info dictionary")
 	}
+	info := root.Info.Dict
 
-	if v, ok := infoDict["name"]; ok {
-		if s, ok := bytesVal(v); ok {
-			meta.Info.Name = string(s)
-		}
+	meta := &Meta{
+		Announce:  root.Announce,
+		InfoHash:  root.Info.Hash,
+		InfoBytes: root.Info.Raw,
+		Comment:   string(root.Comment),
+		CreatedBy: string(root.CreatedBy),
+		Encoding:  string(root.Encoding),
+		Info: Info{
+			Name:        info.Name,
+			PieceLength: info.PieceLength,
+			Pieces:      info.Pieces,
+			NameUTF8:    info.NameUTF8,
+			Private:     info.Private == 1,
+			Source:      info.Source,
+		},
 	}
-	if v, ok := infoDict["piece length"]; ok {
-		if n, ok := intVal(v); ok {
-			meta.Info.PieceLength = n
-		}
+	if info.Length != nil {
+		meta.Info.Length = *info.Length
+		meta.Info.hasLength = true
 	}
-	if v, ok := infoDict["pieces"]; ok {
-		if b, ok := v.([]byte); ok {
-			meta.Info.Pieces = b
-		}
+	if root.CreationDate != 0 {
+		meta.CreationDate = time.Unix(int64(root.CreationDate), 0).UTC()
 	}
-	if v, ok := infoDict["length"]; ok {
-		if n, ok := intVal(v); ok {
-			meta.Info.Length = n
+	for _, tier := range root.AnnounceList {
+		if len(tier) > 0 {
+			meta.AnnounceList = append(meta.AnnounceList, tier)
 		}
 	}
-	if v, ok := infoDict["files"]; ok {
-		list, ok := v.([]bencode.Value)
-		if !ok {
-			return nil, errors.New("invalid torrent: info.files is not a list")
-		}
-		for _, fv := range list {
-			fd, ok := fv.(map[string]bencode.Value)
-			if !ok {
-				continue
-			}
-			var f File
-			if l, ok := intVal(fd["length"]); ok {
-				f.Length = l
-			}
-			if pv, ok := fd["path"]; ok {
-				if plist, ok := pv.([]bencode.Value); ok {
-					for _, pe := range plist {
-						if b, ok := bytesVal(pe); ok {
-							f.Path = append(f.Path, string(b))
-						}
-					}
-				}
-			}
-			meta.Info.Files = append(meta.Info.Files, f)
-		}
+	for _, f := range info.Files {
+		meta.Info.Files = append(meta.Info.Files, File{Path: f.Path, Length: f.Length, PathUTF8: f.PathUTF8, Attr: f.Attr})
+	}
+	if err := parseV2(meta, &root); err != nil {
+		return nil, fmt.Errorf("invalid torrent: %w", err)
+	}
+	if err := meta.checkPaths(false); err != nil {
+		return nil, fmt.Errorf("invalid torrent: %w", err)
 	}
-
 	return meta, nil
 }
 
-func bytesVal(v bencode.Value) ([]byte, bool) {
-	b, ok := v.([]byte)
-	return b, ok
-}
-
-func intVal(v bencode.Value) (int64, bool) {
-	n, ok := v.(int64)
-	return n, ok
-}
-
 // InfoHashHex returns the info hash as a 40-character hex string.
 func (m *Meta) InfoHashHex() string {
 	return hex.EncodeToString(m.InfoHash[:])
 }
 
-// PieceCount returns the number of pieces (length of pieces / 20).
+// PieceCount returns the number of pieces (length of pieces / 20). A v2-only torrent has
+// no pieces blob; its pieces are counted per file, since each file starts a new piece.
 func (m *Meta) PieceCount() int {
+	if !m.IsV1() && m.IsV2() && m.Info.PieceLength > 0 {
+		n := 0
+		for _, f := range m.Info.FileTree {
+			n += int((f.Length + m.Info.PieceLength - 1) / m.Info.PieceLength)
+		}
+		return n
+	}
 	if len(m.Info.Pieces)%20 != 0 {
 		return 0
 	}
 	return len(m.Info.Pieces) / 20
 }
 
-// TotalSize returns total content length (single-file: info.length; multi-file: sum of file lengths).
+// TotalSize returns total content length (single-file: info.length; multi-file: sum of file lengths,
+// including padding files; v2-only: sum of the file tree).
 func (m *Meta) TotalSize() int64 {
+	if !m.IsV1() && m.IsV2() {
+		var total int64
+		for _, f := range m.Info.FileTree {
+			total += f.Length
+		}
+		return total
+	}
 	if len(m.Info.Files) == 0 {
 		return m.Info.Length
 	}
@@ -166,12 +262,22 @@ func (m *Meta) TotalSize() int64 {
 	return total
 }
 
-// FileCount returns 1 for single-file, len(info.files) for multi-file.
+// FileCount returns 1 for single-file, the number of info.files entries other than padding
+// files for multi-file, and the number of file tree entries for v2-only.
 func (m *Meta) FileCount() int {
+	if !m.IsV1() && m.IsV2() {
+		return len(m.Info.FileTree)
+	}
 	if len(m.Info.Files) == 0 {
 		return 1
 	}
-	return len(m.Info.Files)
+	n := 0
+	for _, f := range m.Info.Files {
+		if !f.IsPadding() {
+			n++
+		}
+	}
+	return n
 }
 
 // TrackerURLs returns the primary announce URL first, then all URLs from announce-list (all tiers).
@@ -2,7 +2,15 @@ package torrent
 
 import (
 	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/harioms1522/BitSwift/internal/bencode"
 )
 
 func TestParseFile_SingleFile(t *testing.T) {
@@ -61,6 +69,22 @@ func TestParseFile_InfoHashDeterministic(t *testing.T) {
 	}
 }
 
+func TestMetainfo_RoundTripKeepsInfoBytes(t *testing.T) {
+	// Unsorted info keys: re-encoding the parsed dict would change the info hash.
+	data := []byte("d4:infod4:name1:a6:lengthi1e12:piece lengthi16384e6:pieces20:" + strings.Repeat("a", 20) + "ee")
+	var root metainfo
+	if err := bencode.UnmarshalWithOptions(data, &root, decodeOptions); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	got, err := bencode.Marshal(root)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Marshal = %q, want the input unchanged", got)
+	}
+}
+
 func TestParseFile_MissingInfo(t *testing.T) {
 	// Root dict without "info" key
 	data := []byte("d8:announce15:http://tracker/e")
@@ -88,3 +112,158 @@ func TestInfoHashHex(t *testing.T) {
 		t.Errorf("InfoHashHex length = %d, want 40", len(hex))
 	}
 }
+
+func TestParseFile_KnownInfoHash(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "valid.torrent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := ParseFile(data)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	if got, want := meta.InfoHashHex(), "f7b11299223da7aa42221d352bf21135524af224"; got != want {
+		t.Errorf("InfoHashHex = %s, want %s", got, want)
+	}
+}
+
+func TestParseFile_MalformedField(t *testing.T) {
+	// "piece length" must be an integer; it is rejected rather than silently dropped.
+	data := []byte("d4:infod6:lengthi1e4:name1:x12:piece length3:abc6:pieces0:ee")
+	if _, err := ParseFile(data); err == nil {
+		t.Fatal("ParseFile expected error for string piece length")
+	}
+}
+
+func TestParseFile_MistypedOptionalFields(t *testing.T) {
+	// Display-only fields of the wrong type are dropped, not fatal.
+	data := []byte("d7:commenti5e10:created byli1ee13:creation date3:now8:encodingde" +
+		"4:infod6:lengthi1e4:name1:x12:piece lengthi16384e6:pieces20:xxxxxxxxxxxxxxxxxxxxee")
+	meta, err := ParseFile(data)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	if meta.Comment != "" || meta.CreatedBy != "" || !meta.CreationDate.IsZero() || meta.Encoding != "" {
+		t.Errorf("mistyped fields = %q, %q, %v, %q, want unset", meta.Comment, meta.CreatedBy, meta.CreationDate, meta.Encoding)
+	}
+	if meta.Info.Name != "x" {
+		t.Errorf("Name = %q", meta.Info.Name)
+	}
+}
+
+func TestParseFile_SyntaxErrorLocation(t *testing.T) {
+	// The error points into the info dict, at its offset in the whole file.
+	data := []byte("d4:infod5:filesld6:lengthi1e4:pathl1:ax:eeeeee")
+	_, err := ParseFile(data)
+	var se *bencode.SyntaxError
+	if !errors.As(err, &se) {
+		t.Fatalf("ParseFile = %v, want *bencode.SyntaxError", err)
+	}
+	if se.Offset != 38 || se.Path != "info.files[0].path[1]" || se.Kind != bencode.InvalidCharacter {
+		t.Errorf("SyntaxError = {%d, %q, %v}", se.Offset, se.Path, se.Kind)
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	for _, name := range []string{"valid.torrent", "hybrid.torrent", "v2.torrent"} {
+		data, info := readTestTorrent(t, name)
+		want, err := ParseFile(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseInfo(info)
+		if err != nil {
+			t.Fatalf("%s: ParseInfo: %v", name, err)
+		}
+		if got.InfoHash != want.InfoHash || got.InfoHashV2 != want.InfoHashV2 || !reflect.DeepEqual(got.Info, want.Info) {
+			t.Errorf("%s: ParseInfo differs from ParseFile", name)
+		}
+		if !bytes.Equal(got.InfoBytes, info) || !bytes.Equal(want.InfoBytes, info) {
+			t.Errorf("%s: InfoBytes is not the info dict", name)
+		}
+		if got.Announce != "" || len(got.TrackerURLs()) != 0 {
+			t.Errorf("%s: ParseInfo has trackers %v", name, got.TrackerURLs())
+		}
+	}
+	if _, err := ParseInfo([]byte("le")); err == nil {
+		t.Error("ParseInfo accepted a list")
+	}
+}
+
+func BenchmarkParseFile(b *testing.B) {
+	for _, name := range []string{"valid.torrent", "game.torrent", "ubuntu-24.04.3-desktop-amd64.iso.torrent"} {
+		data, err := os.ReadFile(filepath.Join("..", "..", "testdata", name))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := ParseFile(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFile_OptionalFields(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "ubuntu-24.04.3-desktop-amd64.iso.torrent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := ParseFile(data)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	if meta.Comment != "Ubuntu CD releases.ubuntu.com" || meta.CreatedBy != "mktorrent 1.1" {
+		t.Errorf("Comment, CreatedBy = %q, %q", meta.Comment, meta.CreatedBy)
+	}
+	if want := time.Date(2025, 8, 7, 10, 28, 19, 0, time.UTC); !meta.CreationDate.Equal(want) {
+		t.Errorf("CreationDate = %v, want %v", meta.CreationDate, want)
+	}
+	if meta.Info.Private || meta.Info.Source != "" || meta.Encoding != "" {
+		t.Errorf("Private, Source, Encoding = %v, %q, %q, want unset", meta.Info.Private, meta.Info.Source, meta.Encoding)
+	}
+
+	root := metainfo{
+		Encoding: "Shift_JIS",
+		Info: rawInfo{Dict: infoDict{
+			Name:        "\x83e\x83X\x83g",
+			NameUTF8:    "テスト",
+			PieceLength: 16384,
+			Pieces:      make([]byte, 20),
+			Private:     1,
+			Source:      "TRK",
+			Files: []fileDict{
+				{Length: 5, Path: []string{"\x83t\x83@\x83C\x83\x8b"}, PathUTF8: []string{"ファイル"}},
+				{Length: 5, Path: []string{"plain"}},
+			},
+		}},
+	}
+	data, err = bencode.Marshal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err = ParseFile(data)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	if !meta.Info.Private || meta.Info.Source != "TRK" || meta.Encoding != "Shift_JIS" {
+		t.Errorf("Private, Source, Encoding = %v, %q, %q", meta.Info.Private, meta.Info.Source, meta.Encoding)
+	}
+	if meta.Info.NameUTF8 != "テスト" || !reflect.DeepEqual(meta.Info.Files[0].PathUTF8, []string{"ファイル"}) {
+		t.Errorf("NameUTF8, PathUTF8 = %q, %q", meta.Info.NameUTF8, meta.Info.Files[0].PathUTF8)
+	}
+	if meta.Info.Files[1].PathUTF8 != nil || !meta.CreationDate.IsZero() {
+		t.Errorf("absent fields = %q, %v, want unset", meta.Info.Files[1].PathUTF8, meta.CreationDate)
+	}
+
+	// The UTF-8 variants are held to the same path rules.
+	root.Info.Dict.Files[0].PathUTF8 = []string{"..", "x"}
+	data, _ = bencode.Marshal(root)
+	var pe *PathError
+	if _, err := ParseFile(data); !errors.As(err, &pe) || pe.Field != "info.files[0].path.utf-8" {
+		t.Errorf("ParseFile = %v, want *PathError in info.files[0].path.utf-8", err)
+	}
+}
@@ -0,0 +1,273 @@
+package torrent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/harioms1522/BitSwift/internal/bencode"
+)
+
+// blockSize is the leaf size of the BEP 52 merkle trees.
+const blockSize = 16 * 1024
+
+// TreeFile is one file of a BitTorrent v2 file tree (BEP 52).
+type TreeFile struct {
+	Path       []string // path components below the torrent name
+	Length     int64
+	PiecesRoot [32]byte // merkle root of the file's 16 KiB blocks; zero for an empty file
+}
+
+// field names f in problems and errors, e.g. "info.file tree.dir/a.txt".
+func (f TreeFile) field() string {
+	return "info.file tree." + strings.Join(f.Path, "/")
+}
+
+// IsV1 reports whether the torrent has a v1 info dict (pieces, and length or files).
+func (m *Meta) IsV1() bool {
+	return len(m.Info.Pieces) > 0
+}
+
+// IsV2 reports whether the torrent has a v2 info dict (meta version 2 and a file tree).
+func (m *Meta) IsV2() bool {
+	return m.Info.MetaVersion == 2
+}
+
+// IsHybrid reports whether the torrent carries both a v1 and a v2 layout of the same files.
+func (m *Meta) IsHybrid() bool {
+	return m.IsV1() && m.IsV2()
+}
+
+// InfoHashV2Hex returns the v2 info hash as a 64-character hex string, or "" for a v1 torrent.
+func (m *Meta) InfoHashV2Hex() string {
+	if !m.IsV2() {
+		return ""
+	}
+	return hex.EncodeToString(m.InfoHashV2[:])
+}
+
+// TruncatedInfoHashV2 returns the first 20 bytes of the v2 info hash, which identifies
+// a v2 torrent wherever a 20-byte hash is expected: tracker announces and the handshake.
+func (m *Meta) TruncatedInfoHashV2() [20]byte {
+	var h [20]byte
+	copy(h[:], m.InfoHashV2[:])
+	return h
+}
+
+// fileTree is a directory of a bencoded v2 file tree. A file is a dictionary whose only
+// key is the empty string, mapping to the file's length and pieces root.
+type fileTree struct {
+	File     *treeFileDict
+	Children map[string]*fileTree
+}
+
+// treeFileDict is the bencoded description of one file in a v2 file tree.
+type treeFileDict struct {
+	Length     int64  `bencode:"length"`
+	PiecesRoot []byte `bencode:"pieces root"`
+}
+
+func (t *fileTree) UnmarshalBencode(data []byte) error {
+	var entries map[string]bencode.RawMessage
+	if err := bencode.UnmarshalWithOptions(data, &entries, decodeOptions); err != nil {
+		return err
+	}
+	for name, raw := range entries {
+		if name == "" {
+			t.File = new(treeFileDict)
+			if err := bencode.Unmarshal(raw, t.File); err != nil {
+				return err
+			}
+			continue
+		}
+		child := new(fileTree)
+		if err := child.UnmarshalBencode(raw); err != nil {
+			return err
+		}
+		if t.Children == nil {
+			t.Children = make(map[string]*fileTree)
+		}
+		t.Children[name] = child
+	}
+	return nil
+}
+
+func (t fileTree) MarshalBencode() ([]byte, error) {
+	entries := make(map[string]any, len(t.Children)+1)
+	if t.File != nil {
+		entries[""] = t.File
+	}
+	for name, child := range t.Children {
+		entries[name] = child
+	}
+	return bencode.Marshal(entries)
+}
+
+// flatten lists the files below t in key order, which is the order of a v2 torrent.
+func (t *fileTree) flatten(prefix []string, out []TreeFile) ([]TreeFile, error) {
+	if t.File != nil {
+		if len(prefix) == 0 {
+			return nil, errors.New("file tree root is a file")
+		}
+		if len(t.Children) > 0 {
+			return nil, fmt.Errorf("file tree entry %q is both a file and a directory", strings.Join(prefix, "/"))
+		}
+		f := TreeFile{Path: prefix, Length: t.File.Length}
+		switch {
+		case f.Length < 0:
+			return nil, fmt.Errorf("file tree entry %q has negative length", strings.Join(prefix, "/"))
+		case f.Length > 0 && len(t.File.PiecesRoot) != sha256.Size:
+			return nil, fmt.Errorf("file tree entry %q has a %d-byte pieces root", strings.Join(prefix, "/"), len(t.File.PiecesRoot))
+		}
+		copy(f.PiecesRoot[:], t.File.PiecesRoot)
+		return append(out, f), nil
+	}
+	if len(t.Children) == 0 {
+		return nil, fmt.Errorf("file tree entry %q is empty", strings.Join(prefix, "/"))
+	}
+	names := make([]string, 0, len(t.Children))
+	for name := range t.Children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var err error
+	for _, name := range names {
+		path := append(append([]string(nil), prefix...), name)
+		if out, err = t.Children[name].flatten(path, out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// parseV2 fills in the v2 parts of meta from the decoded root dictionary.
+func parseV2(meta *Meta, root *metainfo) error {
+	info := &root.Info.Dict
+	if info.MetaVersion == 0 || info.MetaVersion == 1 {
+		return nil
+	}
+	if info.MetaVersion != 2 {
+		return fmt.Errorf("unsupported meta version %d", info.MetaVersion)
+	}
+	if info.FileTree == nil {
+		return errors.New("meta version 2 without a file tree")
+	}
+	files, err := info.FileTree.flatten(nil, nil)
+	if err != nil {
+		return err
+	}
+	meta.Info.MetaVersion = 2
+	meta.Info.FileTree = files
+	meta.InfoHashV2 = root.Info.HashV2
+	if len(root.PieceLayers) > 0 {
+		meta.PieceLayers = make(map[[32]byte][]byte, len(root.PieceLayers))
+		for k, layer := range root.PieceLayers {
+			if len(k) != sha256.Size {
+				return fmt.Errorf("piece layers key of %d bytes", len(k))
+			}
+			meta.PieceLayers[[32]byte([]byte(k))] = layer
+		}
+	}
+	if !meta.IsV1() {
+		meta.InfoHash = meta.TruncatedInfoHashV2()
+	}
+	return nil
+}
+
+// merkleRoot returns the root of a BEP 52 merkle tree whose bottom layer is hashes, padded
+// to a power of two with pad, the hash of an all-zero subtree of the same height.
+func merkleRoot(hashes [][32]byte, pad [32]byte) [32]byte {
+	if len(hashes) == 0 {
+		return [32]byte{}
+	}
+	n := 1
+	for n < len(hashes) {
+		n *= 2
+	}
+	layer := make([][32]byte, n)
+	copy(layer, hashes)
+	for i := len(hashes); i < n; i++ {
+		layer[i] = pad
+	}
+	for len(layer) > 1 {
+		for i := 0; i < len(layer)/2; i++ {
+			layer[i] = sha256.Sum256(append(layer[2*i][:], layer[2*i+1][:]...))
+		}
+		layer = layer[:len(layer)/2]
+	}
+	return layer[0]
+}
+
+// zeroPieceHash returns the hash of a piece-layer node covering pieceLength zero bytes
+// beyond the end of a file: a subtree of zero leaf hashes.
+func zeroPieceHash(pieceLength int64) [32]byte {
+	var h [32]byte
+	for n := pieceLength / blockSize; n > 1; n /= 2 {
+		h = sha256.Sum256(append(h[:], h[:]...))
+	}
+	return h
+}
+
+// checkV2 reports the problems of the v2 parts of m through add.
+func (m *Meta) checkV2(add func(kind ProblemKind, field, format string, args ...any)) {
+	pl := m.Info.PieceLength
+	if pl < blockSize || pl&(pl-1) != 0 {
+		add(InvalidPieceLength, "info.piece length", "must be a power of two of at least %d in a v2 torrent, got %d", blockSize, pl)
+		return
+	}
+	pad := zeroPieceHash(pl)
+	for _, f := range m.Info.FileTree {
+		field := f.field()
+		if f.Length <= pl {
+			continue // the pieces root is the hash of the single piece; there is no layer
+		}
+		layer, ok := m.PieceLayers[f.PiecesRoot]
+		want := (f.Length + pl - 1) / pl
+		switch {
+		case !ok:
+			add(InvalidPieceLayers, field, "has no piece layer")
+		case int64(len(layer)) != want*sha256.Size:
+			add(InvalidPieceLayers, field, "piece layer has %d bytes, want %d", len(layer), want*sha256.Size)
+		default:
+			hashes := make([][32]byte, want)
+			for i := range hashes {
+				copy(hashes[i][:], layer[i*sha256.Size:])
+			}
+			if merkleRoot(hashes, pad) != f.PiecesRoot {
+				add(InvalidPieceLayers, field, "piece layer does not match the pieces root")
+			}
+		}
+	}
+
+	if m.IsHybrid() {
+		var v1 []TreeFile
+		if len(m.Info.Files) == 0 {
+			v1 = []TreeFile{{Path: []string{m.Info.Name}, Length: m.Info.Length}}
+		}
+		for _, f := range m.Info.Files {
+			if !f.IsPadding() {
+				v1 = append(v1, TreeFile{Path: f.Path, Length: f.Length})
+			}
+		}
+		if !sameFiles(v1, m.Info.FileTree) {
+			add(HybridMismatch, "info", "v1 files and v2 file tree describe different files")
+		}
+	}
+}
+
+// sameFiles reports whether a and b list the same paths and lengths in the same order.
+func sameFiles(a, b []TreeFile) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Length != b[i].Length || !slices.Equal(a[i].Path, b[i].Path) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/harioms1522/BitSwift/internal/bencode"
+)
+
+// The v2 and hybrid testdata torrents describe the same two files, with 32 KiB pieces.
+func v2TestFiles() (a, b []byte) {
+	a = []byte("hello")
+	b = make([]byte, 80000)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	return a, b
+}
+
+// fileRoot computes the BEP 52 pieces root of data from its 16 KiB blocks.
+func fileRoot(data []byte) [32]byte {
+	var leaves [][32]byte
+	for len(data) > 0 {
+		n := min(blockSize, len(data))
+		leaves = append(leaves, sha256.Sum256(data[:n]))
+		data = data[n:]
+	}
+	return merkleRoot(leaves, [32]byte{})
+}
+
+func readTestTorrent(t *testing.T, name string) (data, info []byte) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var root struct {
+		Info bencode.RawMessage `bencode:"info"`
+	}
+	if err := bencode.Unmarshal(data, &root); err != nil {
+		t.Fatal(err)
+	}
+	return data, root.Info
+}
+
+func TestParseFile_V2(t *testing.T) {
+	data, info := readTestTorrent(t, "v2.torrent")
+	meta, err := ParseFileStrict(data)
+	if err != nil {
+		t.Fatalf("ParseFileStrict: %v", err)
+	}
+	if !meta.IsV2() || meta.IsV1() || meta.IsHybrid() {
+		t.Errorf("IsV1, IsV2, IsHybrid = %v, %v, %v, want false, true, false", meta.IsV1(), meta.IsV2(), meta.IsHybrid())
+	}
+	if want := sha256.Sum256(info); meta.InfoHashV2 != want {
+		t.Errorf("InfoHashV2 = %x, want %x", meta.InfoHashV2, want)
+	}
+	if got := meta.InfoHashV2Hex(); got != hex.EncodeToString(meta.InfoHashV2[:]) {
+		t.Errorf("InfoHashV2Hex = %s", got)
+	}
+	if want := meta.TruncatedInfoHashV2(); meta.InfoHash != want || !reflect.DeepEqual(want[:], meta.InfoHashV2[:20]) {
+		t.Errorf("InfoHash = %x, want truncated v2 hash %x", meta.InfoHash, meta.InfoHashV2[:20])
+	}
+
+	a, b := v2TestFiles()
+	want := []TreeFile{
+		{Path: []string{"a.txt"}, Length: 5, PiecesRoot: fileRoot(a)},
+		{Path: []string{"dir", "b.bin"}, Length: 80000, PiecesRoot: fileRoot(b)},
+	}
+	if !reflect.DeepEqual(meta.Info.FileTree, want) {
+		t.Errorf("FileTree = %+v, want %+v", meta.Info.FileTree, want)
+	}
+	if len(meta.PieceLayers) != 1 || len(meta.PieceLayers[want[1].PiecesRoot]) != 3*32 {
+		t.Errorf("PieceLayers = %d layers, want one of 3 hashes for dir/b.bin", len(meta.PieceLayers))
+	}
+	if meta.TotalSize() != 80005 || meta.FileCount() != 2 || meta.PieceCount() != 4 {
+		t.Errorf("TotalSize, FileCount, PieceCount = %d, %d, %d, want 80005, 2, 4", meta.TotalSize(), meta.FileCount(), meta.PieceCount())
+	}
+	if _, err := meta.Layout(); err == nil {
+		t.Error("Layout of a v2-only torrent succeeded")
+	}
+}
+
+func TestParseFile_Hybrid(t *testing.T) {
+	data, info := readTestTorrent(t, "hybrid.torrent")
+	meta, err := ParseFileStrict(data)
+	if err != nil {
+		t.Fatalf("ParseFileStrict: %v", err)
+	}
+	if !meta.IsHybrid() {
+		t.Error("IsHybrid = false")
+	}
+	if want := sha1.Sum(info); meta.InfoHash != want {
+		t.Errorf("InfoHash = %x, want SHA-1 %x", meta.InfoHash, want)
+	}
+	if want := sha256.Sum256(info); meta.InfoHashV2 != want {
+		t.Errorf("InfoHashV2 = %x, want %x", meta.InfoHashV2, want)
+	}
+	if meta.FileCount() != 2 || !meta.Info.Files[1].IsPadding() {
+		t.Errorf("FileCount = %d, padding = %v; want 2 files and a padding file", meta.FileCount(), meta.Info.Files[1].IsPadding())
+	}
+
+	// The v1 pieces cover the files with the padding between them.
+	a, b := v2TestFiles()
+	stream := append(append(append([]byte(nil), a...), make([]byte, 32768-len(a))...), b...)
+	if got := expectedPieces(stream, 32768); !reflect.DeepEqual(got, meta.Info.Pieces) {
+		t.Error("v1 pieces do not match the padded stream")
+	}
+	l, err := meta.Layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first, end := l.FilePieces(2); first != 1 || end != 4 {
+		t.Errorf("FilePieces(dir/b.bin) = [%d, %d), want [1, 4)", first, end)
+	}
+}
+
+func TestValidate_V2(t *testing.T) {
+	data, _ := readTestTorrent(t, "hybrid.torrent")
+	tests := []struct {
+		name   string
+		modify func(m *Meta)
+		want   ProblemKind
+	}{
+		{"missing layer", func(m *Meta) { m.PieceLayers = nil }, InvalidPieceLayers},
+		{"short layer", func(m *Meta) {
+			for k, v := range m.PieceLayers {
+				m.PieceLayers[k] = v[:64]
+			}
+		}, InvalidPieceLayers},
+		{"wrong layer", func(m *Meta) {
+			for k, v := range m.PieceLayers {
+				bad := append([]byte(nil), v...)
+				bad[0] ^= 1
+				m.PieceLayers[k] = bad
+			}
+		}, InvalidPieceLayers},
+		{"piece length", func(m *Meta) { m.Info.PieceLength = 20000 }, InvalidPieceLength},
+		{"hybrid file length", func(m *Meta) { m.Info.Files[2].Length-- }, HybridMismatch},
+		{"hybrid file name", func(m *Meta) { m.Info.FileTree[0].Path = []string{"b.txt"} }, HybridMismatch},
+	}
+	for _, tt := range tests {
+		meta, err := ParseFile(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.modify(meta)
+		var ve *ValidationError
+		if err := meta.Validate(); !errors.As(err, &ve) || !ve.Has(tt.want) {
+			t.Errorf("%s: Validate = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseFile_V2Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unsupported version", "d4:infod12:meta versioni3e4:name1:x12:piece lengthi16384eee"},
+		{"no file tree", "d4:infod12:meta versioni2e4:name1:x12:piece lengthi16384eee"},
+		{"empty directory", "d4:infod9:file treed1:ade12:meta versioni2e4:name1:x12:piece lengthi16384eee"},
+		{"short pieces root", "d4:infod9:file treed1:ad0:d6:lengthi1e11:pieces root2:xxeee12:meta versioni2e4:name1:x12:piece lengthi16384eee"},
+		{"unsafe name", "d4:infod9:file treed2:..d0:d6:lengthi0eee12:meta versioni2e4:name1:x12:piece lengthi16384eee"},
+	}
+	for _, tt := range tests {
+		if _, err := ParseFile([]byte(tt.input)); err == nil {
+			t.Errorf("%s: ParseFile succeeded", tt.name)
+		}
+	}
+}
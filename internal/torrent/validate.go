@@ -0,0 +1,157 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+)
+
+// ProblemKind classifies a Problem found by Validate.
+type ProblemKind int
+
+const (
+	MissingName        ProblemKind = iota + 1 // info.name is empty
+	UnsafePath                                // info.name or a file path is unsafe (see PathError)
+	InvalidPieceLength                        // piece length is zero or negative
+	InvalidPieces                             // pieces is not a multiple of 20 bytes
+	PieceCountMismatch                        // number of piece hashes does not match the total size
+	LengthAndFiles                            // both info.length and info.files are present
+	NegativeLength                            // info.length or a file length is negative
+	InvalidPieceLayers                        // v2: a piece layer is missing or does not match its pieces root
+	HybridMismatch                            // hybrid: the v1 and v2 parts list different files
+)
+
+var problemKindNames = map[ProblemKind]string{
+	MissingName:        "missing name",
+	UnsafePath:         "unsafe path",
+	InvalidPieceLength: "invalid piece length",
+	InvalidPieces:      "invalid pieces",
+	PieceCountMismatch: "piece count mismatch",
+	LengthAndFiles:     "both length and files",
+	NegativeLength:     "negative length",
+	InvalidPieceLayers: "invalid piece layers",
+	HybridMismatch:     "hybrid mismatch",
+}
+
+func (k ProblemKind) String() string {
+	if s, ok := problemKindNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("ProblemKind(%d)", int(k))
+}
+
+// Problem is one violated invariant of a torrent.
+type Problem struct {
+	Kind    ProblemKind
+	Field   string // e.g. "info.pieces" or "info.files[2].length"
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.Field + ": " + p.Message
+}
+
+// ValidationError lists every problem Validate found.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.String()
+	}
+	return "invalid torrent: " + strings.Join(msgs, "; ")
+}
+
+// Has reports whether the error includes a problem of kind k.
+func (e *ValidationError) Has(k ProblemKind) bool {
+	for _, p := range e.Problems {
+		if p.Kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the invariants ParseFile does not enforce: a name, file names that can be
+// created on every platform, a positive piece length, a pieces blob of whole SHA-1 hashes
+// with one hash per piece of content, exactly one of length and files, and no negative
+// lengths. For v2 and hybrid torrents it also checks the piece layers against their pieces
+// roots and that both layouts list the same files. It returns a *ValidationError listing
+// every problem, or nil.
+func (m *Meta) Validate() error {
+	var probs []Problem
+	add := func(kind ProblemKind, field, format string, args ...any) {
+		probs = append(probs, Problem{Kind: kind, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if m.Info.Name == "" {
+		add(MissingName, "info.name", "missing or empty")
+	} else if err := checkName("info.name", m.Info.Name, true); err != nil {
+		add(UnsafePath, err.Field, "%q %s", err.Component, err.Reason)
+	}
+	if (m.Info.hasLength || m.Info.Length != 0) && len(m.Info.Files) > 0 {
+		add(LengthAndFiles, "info", "has both length and files")
+	}
+	if m.Info.Length < 0 {
+		add(NegativeLength, "info.length", "is negative (%d)", m.Info.Length)
+	}
+	lengthsOK := m.Info.Length >= 0
+	for i, f := range m.Info.Files {
+		if f.Length < 0 {
+			add(NegativeLength, fmt.Sprintf("info.files[%d].length", i), "is negative (%d)", f.Length)
+			lengthsOK = false
+		}
+		if err := checkFilePath(fmt.Sprintf("info.files[%d].path", i), f.Path, true); err != nil {
+			add(UnsafePath, err.Field, "%q %s", err.Component, err.Reason)
+		}
+	}
+	for _, f := range m.Info.FileTree {
+		if err := checkFilePath(f.field(), f.Path, true); err != nil {
+			add(UnsafePath, err.Field, "%q %s", err.Component, err.Reason)
+		}
+	}
+
+	piecesOK := true
+	if m.Info.PieceLength <= 0 {
+		add(InvalidPieceLength, "info.piece length", "must be positive, got %d", m.Info.PieceLength)
+		piecesOK = false
+	}
+	if len(m.Info.Pieces)%sha1.Size != 0 {
+		add(InvalidPieces, "info.pieces", "length %d is not a multiple of %d", len(m.Info.Pieces), sha1.Size)
+		piecesOK = false
+	}
+	if piecesOK && lengthsOK && (m.IsV1() || !m.IsV2()) {
+		total := m.TotalSize()
+		want := (total + m.Info.PieceLength - 1) / m.Info.PieceLength
+		if got := int64(len(m.Info.Pieces) / sha1.Size); got != want {
+			add(PieceCountMismatch, "info.pieces", "has %d hashes, but %d bytes in pieces of %d need %d",
+				got, total, m.Info.PieceLength, want)
+		}
+	}
+
+	if m.IsV2() {
+		m.checkV2(add)
+	}
+
+	if len(probs) > 0 {
+		return &ValidationError{Problems: probs}
+	}
+	return nil
+}
+
+// ParseFileStrict is like ParseFile, but also rejects non-canonical bencode (so the info
+// hash cannot depend on how the file was encoded) and any problem reported by Validate.
+func ParseFileStrict(data []byte) (*Meta, error) {
+	opts := decodeOptions
+	opts.Strict = true
+	meta, err := parseFile(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := meta.Validate(); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
@@ -0,0 +1,144 @@
+package torrent
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func validMeta() *Meta {
+	return &Meta{Info: Info{
+		Name:        "ok",
+		PieceLength: 16,
+		Pieces:      make([]byte, 3*20),
+		Files:       []File{{Path: []string{"a"}, Length: 20}, {Path: []string{"b"}, Length: 20}},
+	}}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(m *Meta)
+		want   []ProblemKind
+	}{
+		{"valid", func(m *Meta) {}, nil},
+		{"missing name", func(m *Meta) { m.Info.Name = "" }, []ProblemKind{MissingName}},
+		{"unsafe name", func(m *Meta) { m.Info.Name = ".." }, []ProblemKind{UnsafePath}},
+		{"zero piece length", func(m *Meta) { m.Info.PieceLength = 0 }, []ProblemKind{InvalidPieceLength}},
+		{"negative piece length", func(m *Meta) { m.Info.PieceLength = -16 }, []ProblemKind{InvalidPieceLength}},
+		{"pieces not multiple of 20", func(m *Meta) { m.Info.Pieces = m.Info.Pieces[:59] }, []ProblemKind{InvalidPieces}},
+		{"too few pieces", func(m *Meta) { m.Info.Pieces = m.Info.Pieces[:40] }, []ProblemKind{PieceCountMismatch}},
+		{"too many pieces", func(m *Meta) { m.Info.Pieces = make([]byte, 80) }, []ProblemKind{PieceCountMismatch}},
+		{"length and files", func(m *Meta) { m.Info.Length = 40 }, []ProblemKind{LengthAndFiles}},
+		{"negative file length", func(m *Meta) { m.Info.Files[1].Length = -1 }, []ProblemKind{NegativeLength}},
+		{"unsafe file path", func(m *Meta) { m.Info.Files[0].Path = []string{"", "x"} }, []ProblemKind{UnsafePath}},
+		{"reserved file name", func(m *Meta) { m.Info.Files[1].Path = []string{"dir", "aux.c"} }, []ProblemKind{UnsafePath}},
+		{"no path components", func(m *Meta) { m.Info.Files[1].Path = nil }, []ProblemKind{UnsafePath}},
+		{"single file", func(m *Meta) { m.Info.Files = nil; m.Info.Length = 33 }, nil},
+		{"single file negative", func(m *Meta) { m.Info.Files = nil; m.Info.Length = -1 }, []ProblemKind{NegativeLength}},
+		{"several", func(m *Meta) {
+			m.Info.Name = ""
+			m.Info.PieceLength = 0
+			m.Info.Pieces = m.Info.Pieces[:7]
+			m.Info.Files[0].Length = -5
+		}, []ProblemKind{MissingName, NegativeLength, InvalidPieceLength, InvalidPieces}},
+	}
+	for _, tt := range tests {
+		m := validMeta()
+		tt.modify(m)
+		err := m.Validate()
+		var got []ProblemKind
+		var ve *ValidationError
+		if errors.As(err, &ve) {
+			for _, p := range ve.Problems {
+				got = append(got, p.Kind)
+			}
+		} else if err != nil {
+			t.Errorf("%s: Validate = %v, want *ValidationError", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Validate problems = %v, want %v (%v)", tt.name, got, tt.want, err)
+		}
+	}
+}
+
+func TestValidate_Message(t *testing.T) {
+	m := validMeta()
+	m.Info.Pieces = m.Info.Pieces[:30]
+	m.Info.Files[1].Length = -2
+	want := "invalid torrent: info.files[1].length: is negative (-2); info.pieces: length 30 is not a multiple of 20"
+	if err := m.Validate(); err == nil || err.Error() != want {
+		t.Errorf("Validate = %v, want %q", err, want)
+	}
+}
+
+func TestParseFileStrict(t *testing.T) {
+	for _, name := range []string{"valid.torrent", "game.torrent", "ubuntu-24.04.3-desktop-amd64.iso.torrent"} {
+		data, err := os.ReadFile(filepath.Join("..", "..", "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ParseFileStrict(data); err != nil {
+			t.Errorf("ParseFileStrict(%s): %v", name, err)
+		}
+	}
+
+	// 3 piece hashes for 100 bytes in 16 KiB pieces: ParseFile accepts it, the strict parse does not.
+	var b bytes.Buffer
+	b.WriteString("d4:infod6:lengthi100e4:name4:test12:piece lengthi16384e6:pieces60:")
+	b.Write(bytes.Repeat([]byte("x"), 60))
+	b.WriteString("ee")
+	if _, err := ParseFile(b.Bytes()); err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	var ve *ValidationError
+	if _, err := ParseFileStrict(b.Bytes()); !errors.As(err, &ve) || !ve.Has(PieceCountMismatch) {
+		t.Errorf("ParseFileStrict = %v, want piece count mismatch", err)
+	}
+
+	// Unsorted keys are rejected.
+	unsorted := []byte("d4:infod4:name4:test6:lengthi1e12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaaee")
+	if _, err := ParseFileStrict(unsorted); err == nil {
+		t.Error("ParseFileStrict accepted unsorted keys")
+	}
+	if _, err := ParseFile(unsorted); err != nil {
+		t.Errorf("ParseFile rejected unsorted keys: %v", err)
+	}
+}
+
+func TestParseFileStrict_MissingName(t *testing.T) {
+	pieces := strings.Repeat("x", 20)
+	for _, data := range []string{
+		"d4:infod6:lengthi1e4:name0:12:piece lengthi16384e6:pieces20:" + pieces + "ee",
+		"d4:infod6:lengthi1e12:piece lengthi16384e6:pieces20:" + pieces + "ee",
+	} {
+		var ve *ValidationError
+		_, err := ParseFileStrict([]byte(data))
+		if !errors.As(err, &ve) || !ve.Has(MissingName) || len(ve.Problems) != 1 {
+			t.Errorf("ParseFileStrict(%q) = %v, want only a missing name", data, err)
+		}
+	}
+}
+
+func TestParseFileStrict_ZeroLengthAndFiles(t *testing.T) {
+	data := "d4:infod5:filesld6:lengthi1e4:pathl1:aeee6:lengthi0e4:name4:test12:piece lengthi16384e6:pieces20:" +
+		strings.Repeat("x", 20) + "ee"
+	var ve *ValidationError
+	if _, err := ParseFileStrict([]byte(data)); !errors.As(err, &ve) || !ve.Has(LengthAndFiles) {
+		t.Errorf("ParseFileStrict = %v, want length and files", err)
+	}
+
+	// The length of a single-file torrent is still read into Info.Length.
+	data = "d4:infod6:lengthi1e4:name4:test12:piece lengthi16384e6:pieces20:" + strings.Repeat("x", 20) + "ee"
+	meta, err := ParseFileStrict([]byte(data))
+	if err != nil {
+		t.Fatalf("single file: %v", err)
+	}
+	if meta.Info.Length != 1 {
+		t.Errorf("single file: length %d, want 1", meta.Info.Length)
+	}
+}
@@ -21,6 +21,15 @@ const (
 	HTTPClientTimeout = 15 * time.Second
 )
 
+// decodeOptions bounds how much work a (possibly hostile) tracker response can cause.
+// A compact list of 50000 peers is 300 KB, well under MaxStringLen.
+var decodeOptions = bencode.DecoderOptions{
+	MaxDepth:       8,
+	MaxStringLen:   1 << 20,
+	MaxListLen:     50000,
+	MaxTotalAllocs: 500000,
+}
+
 // Peer is a single peer address.
 type Peer struct {
 	IP   string
@@ -93,55 +102,83 @@ func Announce(ctx context.Context, announceURL string, infoHash [20]byte, peerID
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("tracker returned %d", resp.StatusCode)
 	}
-	// Read body (bencoded)
-	body := make([]byte, 0, 64*1024)
-	buf := make([]byte, 4096)
-	for {
-		n, err := resp.Body.Read(buf)
-		body = append(body, buf[:n]...)
-		if err != nil {
-			break
+	// Decode the bencoded body straight from the connection.
+	var r announceResponse
+	dec := bencode.NewDecoder(resp.Body)
+	dec.SetOptions(decodeOptions)
+	if err := dec.Decode(&r); err != nil {
+		return nil, decodeError(err)
+	}
+	return r.response()
+}
+
+// announceResponse is the bencoded tracker announce response.
+type announceResponse struct {
+	Peers *peerList `bencode:"peers"`
+}
+
+// peerDict is one entry of a non-compact peers list. Port is nil when the key is missing.
+type peerDict struct {
+	IP   string `bencode:"ip"`
+	Port *int64 `bencode:"port"`
+}
+
+// peerList decodes the "peers" value in either compact or non-compact form.
+type peerList []Peer
+
+func (p *peerList) UnmarshalBencode(data []byte) error {
+	switch data[0] {
+	case 'l':
+		// Non-compact: list of dicts with "ip" (string), "port" (int)
+		var list []bencode.RawMessage
+		if err := bencode.Unmarshal(data, &list); err != nil {
+			return err
 		}
+		*p = parsePeersList(list)
+		return nil
+	case 'i', 'd':
+		return ErrNoPeers
+	}
+	// Compact: single string, 6 bytes per peer (4 IP + 2 port big-endian)
+	var b []byte
+	if err := bencode.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	peers, err := parsePeersCompact(b)
+	if err != nil {
+		return err
 	}
-	return ParseAnnounceResponse(body)
+	*p = peers
+	return nil
 }
 
 // ParseAnnounceResponse decodes bencoded tracker response and extracts peers.
 // Supports compact (binary string, 6 bytes per peer: 4 IP + 2 port BE) and
 // non-compact (list of dicts with "ip" and "port").
 func ParseAnnounceResponse(data []byte) (*Response, error) {
-	root, err := bencode.Decode(data)
-	if err != nil {
-		return nil, fmt.Errorf("decode tracker response: %w", err)
-	}
-	dict, ok := root.(map[string]bencode.Value)
-	if !ok {
-		return nil, errors.New("tracker response root is not a dictionary")
+	var r announceResponse
+	if err := bencode.UnmarshalWithOptions(data, &r, decodeOptions); err != nil {
+		return nil, decodeError(err)
 	}
-	peers, err := parsePeers(dict)
-	if err != nil {
-		return nil, err
+	return r.response()
+}
+
+func (r *announceResponse) response() (*Response, error) {
+	if r.Peers == nil {
+		return nil, ErrNoPeers
 	}
+	peers := []Peer(*r.Peers)
 	if len(peers) > MaxPeers {
 		peers = peers[:MaxPeers]
 	}
 	return &Response{Peers: peers}, nil
 }
 
-func parsePeers(dict map[string]bencode.Value) ([]Peer, error) {
-	v, ok := dict["peers"]
-	if !ok {
-		return nil, ErrNoPeers
-	}
-	// Compact: single string, 6 bytes per peer (4 IP + 2 port big-endian)
-	if b, ok := v.([]byte); ok {
-		return parsePeersCompact(b)
+func decodeError(err error) error {
+	if errors.Is(err, ErrNoPeers) {
+		return ErrNoPeers
 	}
-	// Non-compact: list of dicts with "ip" (string), "port" (int)
-	if list, ok := v.([]bencode.Value); ok {
-		return parsePeersList(list)
-	}
-	return nil, ErrNoPeers
+	return fmt.Errorf("decode tracker response: %w", err)
 }
 
 func parsePeersCompact(b []byte) ([]Peer, error) {
@@ -157,32 +194,20 @@ func parsePeersCompact(b []byte) ([]Peer, error) {
 	return peers, nil
 }
 
-func parsePeersList(list []bencode.Value) ([]Peer, error) {
+// parsePeersList skips entries that are not dicts or lack a valid "ip" or "port".
+func parsePeersList(list []bencode.RawMessage) []Peer {
 	var peers []Peer
-	for _, v := range list {
-		d, ok := v.(map[string]bencode.Value)
-		if !ok {
-			continue
-		}
-		ipVal, ok := d["ip"]
-		if !ok {
-			continue
-		}
-		ipStr, ok := ipVal.([]byte)
-		if !ok {
-			continue
-		}
-		portVal, ok := d["port"]
-		if !ok {
+	for _, raw := range list {
+		var d peerDict
+		if bencode.Unmarshal(raw, &d) != nil {
 			continue
 		}
-		portInt, ok := portVal.(int64)
-		if !ok || portInt < 0 || portInt > 65535 {
+		if d.IP == "" || d.Port == nil || *d.Port < 0 || *d.Port > 65535 {
 			continue
 		}
-		peers = append(peers, Peer{IP: string(ipStr), Port: uint16(portInt)})
+		peers = append(peers, Peer{IP: d.IP, Port: uint16(*d.Port)})
 	}
-	return peers, nil
+	return peers
 }
 
 // AnnounceWithRetry tries the first URL with backoff, then the rest of the list.
@@ -1,7 +1,11 @@
 package tracker
 
 import (
+	"errors"
+	"strings"
 	"testing"
+
+	"github.com/harioms1522/BitSwift/internal/bencode"
 )
 
 func TestValidateURL_AcceptsHTTP(t *testing.T) {
@@ -108,3 +112,31 @@ func TestParseAnnounceResponse_CapMaxPeers(t *testing.T) {
 		t.Errorf("len(Peers) = %d, want cap %d", len(resp.Peers), MaxPeers)
 	}
 }
+
+func TestParseAnnounceResponse_MalformedPeerEntries(t *testing.T) {
+	// Entries that are not dicts, or lack a valid ip or port, are skipped one by one.
+	data := []byte("d5:peersl" +
+		"i1e" +
+		"d2:ipi1e4:porti6881ee" +
+		"d2:ip7:1.2.3.4e" +
+		"d2:ip7:1.2.3.44:porti70000ee" +
+		"d2:ip7:5.6.7.84:porti6881ee" +
+		"ee")
+	resp, err := ParseAnnounceResponse(data)
+	if err != nil {
+		t.Fatalf("ParseAnnounceResponse: %v", err)
+	}
+	if len(resp.Peers) != 1 || resp.Peers[0] != (Peer{IP: "5.6.7.8", Port: 6881}) {
+		t.Errorf("Peers = %+v, want only 5.6.7.8:6881", resp.Peers)
+	}
+}
+
+func TestParseAnnounceResponse_Limits(t *testing.T) {
+	// Deeply nested junk is rejected with a limit error rather than recursed into.
+	data := []byte("d5:extra" + strings.Repeat("l", 100) + strings.Repeat("e", 100) + "5:peers0:e")
+	_, err := ParseAnnounceResponse(data)
+	var le *bencode.LimitError
+	if !errors.As(err, &le) || le.Limit != "MaxDepth" {
+		t.Errorf("ParseAnnounceResponse = %v, want MaxDepth LimitError", err)
+	}
+}